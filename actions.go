@@ -0,0 +1,139 @@
+package feednotifier
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// itemAction is the feed item a set of inline buttons was attached to
+type itemAction struct {
+	FeedURL string
+	Title   string
+	Link    string
+	Torrent string
+}
+
+// itemActions remembers the items behind recently sent buttons; callback
+// data is limited to 64 bytes so buttons only carry an id. Buttons sent
+// before a restart expire.
+type itemActions struct {
+	sync.Mutex
+	items map[string]itemAction
+	order []string
+	// next is the id of the next action. It starts at the time the process
+	// started so buttons left from an earlier run don't match new actions
+	next int64
+}
+
+const maxItemActions = 1000
+
+var telegramActions = &itemActions{items: make(map[string]itemAction)}
+
+func (a *itemActions) add(action itemAction) string {
+	a.Lock()
+	defer a.Unlock()
+	if a.next == 0 {
+		a.next = time.Now().UnixNano()
+	}
+	id := strconv.FormatInt(a.next, 36)
+	a.next++
+	a.items[id] = action
+	a.order = append(a.order, id)
+	if len(a.order) > maxItemActions {
+		delete(a.items, a.order[0])
+		a.order = a.order[1:]
+	}
+	return id
+}
+
+func (a *itemActions) get(id string) (itemAction, bool) {
+	a.Lock()
+	defer a.Unlock()
+	action, ok := a.items[id]
+	return action, ok
+}
+
+type copyText struct {
+	Text string `json:"text"`
+}
+
+type inlineButton struct {
+	Text         string    `json:"text"`
+	URL          string    `json:"url,omitempty"`
+	CallbackData string    `json:"callback_data,omitempty"`
+	CopyText     *copyText `json:"copy_text,omitempty"`
+}
+
+type inlineKeyboard struct {
+	InlineKeyboard [][]inlineButton `json:"inline_keyboard"`
+}
+
+// callback actions
+const (
+	actionMute     = "mute"
+	actionLike     = "like"
+	actionNever    = "never"
+	actionDownload = "download"
+)
+
+// muteDuration is how long the "mute this feed" button mutes a feed for
+const muteDuration = 24 * time.Hour
+
+// maxCopyText is telegram's limit for copy_text buttons
+const maxCopyText = 256
+
+// magnetURI returns the item's magnet link, shortened to fit a copy button
+func magnetURI(item *FeedItem) string {
+	magnet := item.Link
+	if !strings.HasPrefix(magnet, "magnet:") {
+		magnet = item.Ext("torrent", "magnetURI")
+	}
+	if !strings.HasPrefix(magnet, "magnet:") || len(magnet) <= maxCopyText {
+		return magnet
+	}
+	// trackers make magnets long; clients find peers through DHT without them
+	parts := strings.Split(magnet, "&")
+	kept := parts[:1]
+	for _, p := range parts[1:] {
+		if !strings.HasPrefix(p, "tr=") {
+			kept = append(kept, p)
+		}
+	}
+	magnet = strings.Join(kept, "&")
+	if len(magnet) > maxCopyText {
+		magnet = parts[0]
+	}
+	return magnet
+}
+
+// itemKeyboard builds the inline buttons attached to an item notification
+func itemKeyboard(item *FeedItem) string {
+	var links []inlineButton
+	if strings.HasPrefix(item.Link, "http://") || strings.HasPrefix(item.Link, "https://") {
+		links = append(links, inlineButton{Text: "Open", URL: item.Link})
+	}
+	if magnet := magnetURI(item); magnet != "" && len(magnet) <= maxCopyText {
+		links = append(links, inlineButton{Text: "Copy magnet", CopyText: &copyText{magnet}})
+	}
+	torrent := torrentURI(item)
+	id := telegramActions.add(itemAction{FeedURL: item.FeedURL, Title: item.Title, Link: item.Link, Torrent: torrent})
+	// items already sent to a client don't need the button
+	if torrent != "" && defaultDownloadClient != "" && !item.Downloaded {
+		links = append(links, inlineButton{Text: "Download", CallbackData: actionDownload + ":" + id})
+	}
+	actions := []inlineButton{
+		{Text: "Mute feed", CallbackData: actionMute + ":" + id},
+		{Text: "More like this", CallbackData: actionLike + ":" + id},
+		{Text: "Never like this", CallbackData: actionNever + ":" + id},
+	}
+	keyboard := inlineKeyboard{}
+	if len(links) > 0 {
+		keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, links)
+	}
+	keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, actions)
+	markup, _ := json.Marshal(keyboard)
+	return string(markup)
+}
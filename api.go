@@ -0,0 +1,406 @@
+package feednotifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	log "github.com/sirupsen/logrus"
+)
+
+// the json api is served under /api/ next to the dashboard and uses the
+// same monitored files and feed state as the scheduler
+
+type apiFeed struct {
+	URL     string            `json:"url"`
+	File    string            `json:"file"`
+	Options map[string]string `json:"options"`
+	Muted   bool              `json:"muted"`
+	State   FeedState         `json:"state"`
+}
+
+type apiFeedRequest struct {
+	URL     string            `json:"url"`
+	File    string            `json:"file"`
+	Options map[string]string `json:"options"`
+}
+
+type apiItem struct {
+	ID     string       `json:"id"`
+	Feed   string       `json:"feed"`
+	Label  string       `json:"label,omitempty"`
+	Title  string       `json:"title"`
+	Link   string       `json:"link"`
+	Sent   time.Time    `json:"sent"`
+	Update bool         `json:"update,omitempty"`
+	Item   *gofeed.Item `json:"item,omitempty"`
+	value  FeedUrl
+	sent   SentItem
+}
+
+type apiItemsPage struct {
+	Items   []apiItem `json:"items"`
+	Page    int       `json:"page"`
+	PerPage int       `json:"perPage"`
+	Total   int       `json:"total"`
+}
+
+type apiNotifier struct {
+	Index  int    `json:"index"`
+	Type   string `json:"type"`
+	Format string `json:"format,omitempty"`
+}
+
+// default and largest page size of GET /api/items
+const (
+	defaultItemsPerPage = 20
+	maxItemsPerPage     = 100
+)
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Errorf("Error writing api response, %v", err)
+	}
+}
+
+func apiError(w http.ResponseWriter, code int, format string, args ...interface{}) {
+	writeJSON(w, code, map[string]string{"error": fmt.Sprintf(format, args...)})
+}
+
+func methodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	apiError(w, http.StatusMethodNotAllowed, "method not allowed")
+}
+
+// sameOrigin guards state changing api calls against other sites. They must
+// be sent as json, which browsers only do across origins after asking the
+// server, and must come from the api's own origin when there is one.
+func sameOrigin(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			h(w, r)
+			return
+		}
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+			apiError(w, http.StatusUnsupportedMediaType, "%s requests must have Content-Type: application/json, even without a body", r.Method)
+			return
+		}
+		if origin := r.Header.Get("Origin"); origin != "" {
+			if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+				apiError(w, http.StatusForbidden, "requests from %s are not allowed", origin)
+				return
+			}
+		}
+		h(w, r)
+	}
+}
+
+// monitoredFile returns the monitored file named filename, or the first one
+// when filename is empty
+func monitoredFile(filename string) *MonitoredFile {
+	for _, mf := range monitoredFiles() {
+		if filename == "" || mf.filename == filename {
+			return mf
+		}
+	}
+	return nil
+}
+
+// monitoredFeed returns the file that monitors feedURL
+func monitoredFeed(feedURL string) (*MonitoredFile, FeedUrl, bool) {
+	for _, mf := range monitoredFiles() {
+		mf.lock.RLock()
+		value, ok := mf.urls[feedURL]
+		mf.lock.RUnlock()
+		if ok {
+			return mf, value, true
+		}
+	}
+	return nil, FeedUrl{}, false
+}
+
+// reload applies a change of the watch file now instead of waiting for the
+// file watcher
+func (mf *MonitoredFile) reload() {
+	go func() {
+		if err := mf.initFile(); err != nil {
+			log.Errorf("file %s could not be read. Error %v", mf.filename, err)
+		}
+	}()
+}
+
+// requestURL returns the feed url of a request, given in a json body as
+// {"url": "..."} or as ?url=
+func requestURL(r *http.Request) (string, error) {
+	var req apiFeedRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		return "", err
+	}
+	if req.URL != "" {
+		return req.URL, nil
+	}
+	return r.URL.Query().Get("url"), nil
+}
+
+// feedsHandler lists feeds on GET, adds one on POST and removes the one
+// given by requestURL on DELETE
+func feedsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		feeds := []apiFeed{}
+		for _, mf := range monitoredFiles() {
+			for _, value := range mf.feeds() {
+				state := loadState(value.url, value.savePath)
+				state.Recent = nil
+				feeds = append(feeds, apiFeed{URL: value.url, File: mf.filename, Options: value.opts, Muted: state.Muted(), State: state})
+			}
+		}
+		writeJSON(w, http.StatusOK, feeds)
+	case http.MethodPost:
+		var req apiFeedRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apiError(w, http.StatusBadRequest, "invalid request, %v", err)
+			return
+		}
+		if err := checkRemoteFeed(FeedSpec{URL: req.URL, Opts: req.Options}); err != nil {
+			apiError(w, http.StatusBadRequest, "%v", err)
+			return
+		}
+		if _, _, ok := monitoredFeed(req.URL); ok {
+			apiError(w, http.StatusConflict, "%s is already monitored", req.URL)
+			return
+		}
+		mf := monitoredFile(req.File)
+		if mf == nil {
+			apiError(w, http.StatusNotFound, "no watch file %s", req.File)
+			return
+		}
+		wf, err := LoadWatchFile(mf.filename)
+		if err != nil {
+			apiError(w, http.StatusInternalServerError, "%v", err)
+			return
+		}
+		if err := wf.Add(FeedSpec{URL: req.URL, Opts: req.Options}); err != nil {
+			apiError(w, http.StatusBadRequest, "%v", err)
+			return
+		}
+		if err := wf.Save(); err != nil {
+			apiError(w, http.StatusInternalServerError, "%v", err)
+			return
+		}
+		log.Infof("Added %s to %s", req.URL, mf.filename)
+		mf.reload()
+		spec, _ := wf.Find(req.URL)
+		writeJSON(w, http.StatusCreated, apiFeed{URL: spec.URL, File: mf.filename, Options: spec.Opts, State: FeedState{URL: spec.URL}})
+	case http.MethodDelete:
+		feedURL, err := requestURL(r)
+		if err != nil {
+			apiError(w, http.StatusBadRequest, "invalid request, %v", err)
+			return
+		}
+		mf, _, ok := monitoredFeed(feedURL)
+		if !ok {
+			apiError(w, http.StatusNotFound, "%s is not monitored", feedURL)
+			return
+		}
+		wf, err := LoadWatchFile(mf.filename)
+		if err != nil {
+			apiError(w, http.StatusInternalServerError, "%v", err)
+			return
+		}
+		if wf.Remove(feedURL) {
+			if err := wf.Save(); err != nil {
+				apiError(w, http.StatusInternalServerError, "%v", err)
+				return
+			}
+			log.Infof("Removed %s from %s", feedURL, mf.filename)
+		}
+		mf.reload()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost, http.MethodDelete)
+	}
+}
+
+// feedCheckHandler checks the feed given by requestURL now
+func feedCheckHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	feedURL, err := requestURL(r)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, "invalid request, %v", err)
+		return
+	}
+	mf, _, ok := monitoredFeed(feedURL)
+	if !ok || !mf.CheckNow(feedURL) {
+		apiError(w, http.StatusNotFound, "%s is not monitored", feedURL)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "checking"})
+}
+
+// notifiedItems returns the items sent for every monitored feed, newest first
+func notifiedItems() []apiItem {
+	var items []apiItem
+	for _, mf := range monitoredFiles() {
+		for _, value := range mf.feeds() {
+			for _, sent := range loadSentItems(value.savePath) {
+				if sent.Item == nil {
+					continue
+				}
+				items = append(items, apiItem{
+					ID:     sent.ID,
+					Feed:   value.url,
+					Label:  value.opts["label"],
+					Title:  sent.Item.Title,
+					Link:   sent.Item.Link,
+					Sent:   sent.Sent,
+					Update: sent.Previous != nil,
+					Item:   sent.Item,
+					value:  value,
+					sent:   sent,
+				})
+			}
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Sent.After(items[j].Sent) })
+	return items
+}
+
+func (i apiItem) matches(q string) bool {
+	q = strings.ToLower(q)
+	if strings.Contains(strings.ToLower(i.Title), q) || strings.Contains(strings.ToLower(i.Link), q) {
+		return true
+	}
+	return i.Item != nil && strings.Contains(strings.ToLower(i.Item.Description), q)
+}
+
+// itemsHandler pages through notified items; ?feed= limits them to a feed
+// and ?q= searches titles, links and descriptions
+func itemsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	feedURL, q := r.FormValue("feed"), strings.TrimSpace(r.FormValue("q"))
+	page, perPage := 1, defaultItemsPerPage
+	if v := r.FormValue("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			apiError(w, http.StatusBadRequest, "invalid page %s", v)
+			return
+		}
+		page = n
+	}
+	if v := r.FormValue("per_page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxItemsPerPage {
+			apiError(w, http.StatusBadRequest, "per_page must be between 1 and %d", maxItemsPerPage)
+			return
+		}
+		perPage = n
+	}
+	matched := []apiItem{}
+	for _, item := range notifiedItems() {
+		if (feedURL == "" || item.Feed == feedURL) && (q == "" || item.matches(q)) {
+			matched = append(matched, item)
+		}
+	}
+	result := apiItemsPage{Items: []apiItem{}, Page: page, PerPage: perPage, Total: len(matched)}
+	if start := (page - 1) * perPage; start < len(matched) {
+		end := start + perPage
+		if end > len(matched) {
+			end = len(matched)
+		}
+		result.Items = matched[start:end]
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// apiNotifiers returns the notifiers used by the monitored files, each once
+func apiNotifiers() []Notifier {
+	var notifiers []Notifier
+	seen := make(map[*[]Notifier]bool)
+	for _, mf := range monitoredFiles() {
+		if mf.notifiers == nil || seen[mf.notifiers] {
+			continue
+		}
+		seen[mf.notifiers] = true
+		notifiers = append(notifiers, *mf.notifiers...)
+	}
+	return notifiers
+}
+
+// notifiersHandler lists the notifiers by type and format; credentials are
+// never returned
+func notifiersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	result := []apiNotifier{}
+	for i, notifier := range apiNotifiers() {
+		kind, format := describeNotifier(notifier)
+		result = append(result, apiNotifier{Index: i, Type: kind, Format: string(format)})
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// replayHandler sends the item given by ?id= again, to the notifier given by
+// its ?notifier= index or to every notifier
+func replayHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	id := r.FormValue("id")
+	var found *apiItem
+	items := notifiedItems()
+	for i := range items {
+		if items[i].ID != "" && items[i].ID == id {
+			found = &items[i]
+			break
+		}
+	}
+	if found == nil {
+		apiError(w, http.StatusNotFound, "no item %s", id)
+		return
+	}
+	notifiers := apiNotifiers()
+	if v := r.FormValue("notifier"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n >= len(notifiers) {
+			apiError(w, http.StatusBadRequest, "no notifier %s", v)
+			return
+		}
+		notifiers = notifiers[n : n+1]
+	}
+	item := found.sent.feedItem(found.value)
+	log.Infof("Replaying item %s of feed %s", item.Title, found.Feed)
+	failed := 0
+	for _, notifier := range notifiers {
+		err := notifier.NotifyItem(item)
+		observeNotification(notifier, err)
+		if err != nil {
+			log.Errorf("Error notifying %v of item %s, %v", notifier, item.Title, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		apiError(w, http.StatusBadGateway, "%d of %d notifiers failed", failed, len(notifiers))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"sent": len(notifiers)})
+}
@@ -0,0 +1,181 @@
+package feednotifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func apiCall(t *testing.T, method, url string, body interface{}, out interface{}) int {
+	var reader *bytes.Reader
+	if body != nil {
+		content, _ := json.Marshal(body)
+		reader = bytes.NewReader(content)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req, _ := http.NewRequest(method, url, reader)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Errorf("%s %s: invalid json, %v", method, url, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestAPI(t *testing.T) {
+	initTemplates()
+	current := "test/zooqle.first.xml"
+	feed := serveFile(&current)
+	defer feed.Close()
+	dir, _ := ioutil.TempDir("", "feednotifier")
+	defer os.RemoveAll(dir)
+	defer func(files []*MonitoredFile) { monitored.files = files }(monitored.files)
+	monitored.files = nil
+
+	watchFile := filepath.Join(dir, "watch.txt")
+	ioutil.WriteFile(watchFile, []byte("# tv\n"+feed.URL+" label=Zooqle\n"), 0644)
+	out := &bytes.Buffer{}
+	notifiers := []Notifier{NewDryRunNotifier(newPushover("abc", "def"), out)}
+	value := FeedUrl{url: feed.URL, savePath: SavePath(dir, feed.URL), basedir: dir, opts: map[string]string{"label": "Zooqle"}}
+	mf := &MonitoredFile{filename: watchFile, urls: map[string]FeedUrl{feed.URL: value}, interval: 30, notifiers: &notifiers, basedir: dir}
+	registerMonitoredFile(mf)
+	update := newFeedItem(&gofeed.Feed{Title: "Zooqle TV"}, &gofeed.Item{Title: "The.Expanse.S03E01", Link: "https://zooqle.com/2"}, value)
+	update.Previous = &gofeed.Item{Title: "The.Expanse.S03E01.720p"}
+	recordSentItems(value.savePath, []*FeedItem{
+		newFeedItem(&gofeed.Feed{Title: "Zooqle TV"}, &gofeed.Item{Title: "Modern.Family.S09E10", Link: "https://zooqle.com/1"}, value),
+		update,
+	})
+
+	ts := httptest.NewServer(newServeMux())
+	defer ts.Close()
+	SetWebOpen(true)
+	defer SetWebOpen(false)
+
+	var feeds []apiFeed
+	if code := apiCall(t, http.MethodGet, ts.URL+"/api/feeds", nil, &feeds); code != http.StatusOK {
+		t.Fatalf("expected feeds, got %d", code)
+	}
+	if len(feeds) != 1 || feeds[0].URL != feed.URL || feeds[0].Options["label"] != "Zooqle" || feeds[0].File != watchFile {
+		t.Errorf("unexpected feeds %+v", feeds)
+	}
+
+	var page apiItemsPage
+	apiCall(t, http.MethodGet, ts.URL+"/api/items?per_page=1&page=2", nil, &page)
+	if page.Total != 2 || len(page.Items) != 1 || page.Items[0].Title != "Modern.Family.S09E10" {
+		t.Errorf("unexpected second page %+v", page)
+	}
+	apiCall(t, http.MethodGet, ts.URL+"/api/items?q=modern", nil, &page)
+	if page.Total != 1 || page.Items[0].Title != "Modern.Family.S09E10" || page.Items[0].ID == "" {
+		t.Fatalf("unexpected search result %+v", page)
+	}
+	if code := apiCall(t, http.MethodGet, ts.URL+"/api/items?per_page=1000", nil, nil); code != http.StatusBadRequest {
+		t.Errorf("expected bad request for a large page, got %d", code)
+	}
+
+	var list []apiNotifier
+	apiCall(t, http.MethodGet, ts.URL+"/api/notifiers", nil, &list)
+	if len(list) != 1 || list[0].Type != "pushover" {
+		t.Errorf("unexpected notifiers %+v", list)
+	}
+
+	if code := apiCall(t, http.MethodPost, ts.URL+"/api/items/replay?notifier=0&id="+page.Items[0].ID, nil, nil); code != http.StatusOK {
+		t.Errorf("expected replay to succeed, got %d", code)
+	}
+	if !strings.Contains(out.String(), "Modern.Family.S09E10") {
+		t.Errorf("expected replayed item to be sent, got %q", out.String())
+	}
+	if code := apiCall(t, http.MethodPost, ts.URL+"/api/items/replay?notifier=5&id="+page.Items[0].ID, nil, nil); code != http.StatusBadRequest {
+		t.Errorf("expected unknown notifier to fail, got %d", code)
+	}
+
+	forged := func(contentType, origin string) int {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+"/api/feeds", strings.NewReader(`{"url":"https://evil.example.com/rss"}`))
+		req.Header.Set("Content-Type", contentType)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := forged("text/plain", ""); code != http.StatusUnsupportedMediaType {
+		t.Errorf("expected a text/plain post to be refused, got %d", code)
+	}
+	if code := forged("application/json", "https://evil.example.com"); code != http.StatusForbidden {
+		t.Errorf("expected a post from another origin to be refused, got %d", code)
+	}
+
+	for _, local := range []apiFeedRequest{
+		{URL: "exec:/bin/sh", Options: map[string]string{"args": "-c id"}},
+		{URL: feed.URL + "/exec", Options: map[string]string{"type": "exec"}},
+		{URL: "file:///etc/shadow"},
+		{URL: "dir:///"},
+		{URL: "/etc", Options: map[string]string{"type": "dir"}},
+	} {
+		if code := apiCall(t, http.MethodPost, ts.URL+"/api/feeds", local, nil); code != http.StatusBadRequest {
+			t.Errorf("expected %s to be refused, got %d", local.URL, code)
+		}
+	}
+
+	added := feed.URL + "/other"
+	if code := apiCall(t, http.MethodPost, ts.URL+"/api/feeds", apiFeedRequest{URL: added, Options: map[string]string{"label": "Other"}}, nil); code != http.StatusCreated {
+		t.Fatalf("expected feed to be added, got %d", code)
+	}
+	if code := apiCall(t, http.MethodPost, ts.URL+"/api/feeds", apiFeedRequest{URL: feed.URL}, nil); code != http.StatusConflict {
+		t.Errorf("expected duplicate feed to conflict, got %d", code)
+	}
+	content, _ := ioutil.ReadFile(watchFile)
+	if !strings.Contains(string(content), added+" label=Other") || !strings.HasPrefix(string(content), "# tv\n") {
+		t.Errorf("expected feed in watch file, got %q", content)
+	}
+	for i := 0; i < 50; i++ {
+		if _, _, ok := monitoredFeed(added); ok {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if code := apiCall(t, http.MethodPost, ts.URL+"/api/feeds/check?url="+added, nil, nil); code != http.StatusAccepted {
+		t.Errorf("expected check of added feed, got %d", code)
+	}
+	if code := apiCall(t, http.MethodPost, ts.URL+"/api/feeds/check", apiFeedRequest{URL: added}, nil); code != http.StatusAccepted {
+		t.Errorf("expected check of a feed given in the body, got %d", code)
+	}
+
+	if code := apiCall(t, http.MethodDelete, ts.URL+"/api/feeds?url="+added, nil, nil); code != http.StatusNoContent {
+		t.Errorf("expected feed to be removed, got %d", code)
+	}
+	content, _ = ioutil.ReadFile(watchFile)
+	if strings.Contains(string(content), added) {
+		t.Errorf("expected feed removed from watch file, got %q", content)
+	}
+	for i := 0; i < 50; i++ {
+		if _, _, ok := monitoredFeed(added); !ok {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	mf.runLock.Lock()
+	mf.runLock.Unlock()
+	if _, _, ok := monitoredFeed(added); ok {
+		t.Errorf("expected removed feed to no longer be monitored")
+	}
+}
@@ -0,0 +1,459 @@
+package feednotifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// TelegramBot long polls a telegram bot for commands that manage
+// subscriptions:
+//
+//	/add <url> [key=value ...]   add a feed to the first watch file
+//	/remove <feed>               remove a feed
+//	/list                        list feeds
+//	/mute <feed> <duration>      stop notifications, e.g. /mute 2 12h
+//	/unmute <feed>               resume notifications
+//	/status                      fetch status of all feeds
+//
+// <feed> is a url, a feed label or the feed's number in /list. Only chats
+// the bot notifies, or that are explicitly allowed, are answered.
+type TelegramBot struct {
+	notifier    *telegramNotifier
+	files       []string
+	basedir     string
+	allowed     map[string]bool
+	offset      int64
+	pollTimeout int
+}
+
+type telegramChat struct {
+	ID int64 `json:"id"`
+}
+
+type telegramMessage struct {
+	MessageID int64        `json:"message_id"`
+	Chat      telegramChat `json:"chat"`
+	Text      string       `json:"text"`
+}
+
+type telegramCallbackQuery struct {
+	ID      string           `json:"id"`
+	Message *telegramMessage `json:"message"`
+	Data    string           `json:"data"`
+}
+
+type telegramUpdate struct {
+	UpdateID      int64                  `json:"update_id"`
+	Message       *telegramMessage       `json:"message"`
+	CallbackQuery *telegramCallbackQuery `json:"callback_query"`
+}
+
+type telegramUpdates struct {
+	Ok     bool             `json:"ok"`
+	Result []telegramUpdate `json:"result"`
+}
+
+// StartTelegramBots starts a command listener for every distinct bot among
+// the telegram notifiers. Watch files are edited in place; running monitors
+// pick the changes up through their file watches.
+func StartTelegramBots(notifiers []Notifier, files []string, basedir string, allowedChats []string) []*TelegramBot {
+	bots := make(map[string]*TelegramBot)
+	var started []*TelegramBot
+	for _, n := range notifiers {
+		tele, ok := n.(*telegramNotifier)
+		if !ok {
+			continue
+		}
+		bot, exists := bots[tele.botId]
+		if !exists {
+			bot = newTelegramBot(tele, files, basedir, allowedChats)
+			bots[tele.botId] = bot
+			started = append(started, bot)
+		}
+		bot.allowed[tele.chatId] = true
+	}
+	for _, bot := range started {
+		log.Infof("Listening for commands to %v from chats %v", bot.notifier, bot.allowed)
+		go bot.Start()
+	}
+	return started
+}
+
+func newTelegramBot(notifier *telegramNotifier, files []string, basedir string, allowedChats []string) *TelegramBot {
+	bot := &TelegramBot{
+		notifier:    notifier,
+		files:       files,
+		basedir:     basedir,
+		allowed:     make(map[string]bool),
+		pollTimeout: 30,
+	}
+	for _, chat := range allowedChats {
+		bot.allowed[chat] = true
+	}
+	return bot
+}
+
+// pollMargin is how much longer than the long poll a getUpdates call may take
+// before it is given up; overridden in tests
+var pollMargin = 10 * time.Second
+
+// Start polls for updates forever
+func (b *TelegramBot) Start() {
+	for {
+		if err := b.poll(); err != nil {
+			log.Errorf("Error polling telegram for updates, %v", err)
+			time.Sleep(time.Duration(b.pollTimeout) * time.Second)
+		}
+	}
+}
+
+// poll fetches and handles one batch of updates
+func (b *TelegramBot) poll() error {
+	data := make(url.Values)
+	data["offset"] = []string{strconv.FormatInt(b.offset, 10)}
+	data["timeout"] = []string{strconv.Itoa(b.pollTimeout)}
+	client := &http.Client{Timeout: time.Duration(b.pollTimeout)*time.Second + pollMargin}
+	responseContent, err := b.notifier.postClient(client, "getUpdates", data)
+	if err != nil {
+		return err
+	}
+	var updates telegramUpdates
+	if err := json.Unmarshal(responseContent, &updates); err != nil {
+		return fmt.Errorf("could not parse updates - %v", err)
+	}
+	for _, update := range updates.Result {
+		b.offset = update.UpdateID + 1
+		b.handleUpdate(update)
+	}
+	return nil
+}
+
+func (b *TelegramBot) handleUpdate(update telegramUpdate) {
+	if update.CallbackQuery != nil {
+		b.handleCallback(update.CallbackQuery)
+		return
+	}
+	if update.Message == nil || !strings.HasPrefix(update.Message.Text, "/") {
+		return
+	}
+	chatID := strconv.FormatInt(update.Message.Chat.ID, 10)
+	if !b.allowed[chatID] {
+		log.Warnf("Ignoring command from unauthorized chat %s: %s", chatID, update.Message.Text)
+		return
+	}
+	log.Infof("Telegram command from chat %s: %s", chatID, update.Message.Text)
+	b.reply(chatID, b.handleCommand(update.Message.Text))
+}
+
+// handleCallback applies the inline button an item notification was
+// answered with
+func (b *TelegramBot) handleCallback(query *telegramCallbackQuery) {
+	if query.Message == nil {
+		return
+	}
+	chatID := strconv.FormatInt(query.Message.Chat.ID, 10)
+	if !b.allowed[chatID] {
+		log.Warnf("Ignoring button from unauthorized chat %s: %s", chatID, query.Data)
+		return
+	}
+	log.Infof("Telegram button from chat %s: %s", chatID, query.Data)
+	b.answerCallback(query.ID, b.applyAction(query.Data))
+}
+
+func (b *TelegramBot) applyAction(data string) string {
+	parts := strings.SplitN(data, ":", 2)
+	if len(parts) != 2 {
+		return "Unknown action"
+	}
+	action, ok := telegramActions.get(parts[1])
+	if !ok {
+		return "This button has expired"
+	}
+	savePath := SavePath(b.basedir, action.FeedURL)
+	switch parts[0] {
+	case actionMute:
+		until := time.Now().Add(muteDuration)
+		MuteFeed(b.basedir, action.FeedURL, until)
+		return fmt.Sprintf("Feed muted until %s", until.Format("2006-01-02 15:04"))
+	case actionLike:
+		pattern := titlePattern(action.Title)
+		if pattern == "" {
+			return "This title has no words to match"
+		}
+		updateState(action.FeedURL, savePath, func(s *FeedState) {
+			s.Like = appendUnique(s.Like, pattern)
+		})
+		return "Noted - titles like this will be marked as liked"
+	case actionNever:
+		pattern := titlePattern(action.Title)
+		if pattern == "" {
+			return "This title has no words to match"
+		}
+		updateState(action.FeedURL, savePath, func(s *FeedState) {
+			s.Exclude = appendUnique(s.Exclude, pattern)
+		})
+		return "Titles like this will no longer be sent"
+	case actionDownload:
+		name := b.downloadClient(action.FeedURL)
+		if downloadClients[name] == nil {
+			return "No download client configured"
+		}
+		if err := downloadClients[name].AddTorrent(action.Torrent); err != nil {
+			log.Errorf("Error adding %s to download client %s, %v", action.Title, name, err)
+			return "Could not add torrent - " + err.Error()
+		}
+		return "Added to " + name
+	}
+	return "Unknown action"
+}
+
+// downloadClient returns the client named by the feed's download option,
+// falling back to the first client configured
+func (b *TelegramBot) downloadClient(feedURL string) string {
+	feeds, _ := b.feeds()
+	for _, feed := range feeds {
+		if name := feed.spec.Opts["download"]; feed.spec.URL == feedURL && downloadClients[name] != nil {
+			return name
+		}
+	}
+	return defaultDownloadClient
+}
+
+func (b *TelegramBot) answerCallback(queryID, text string) {
+	data := make(url.Values)
+	data["callback_query_id"] = []string{queryID}
+	data["text"] = []string{text}
+	if _, err := b.notifier.post("answerCallbackQuery", data); err != nil {
+		log.Errorf("Error answering telegram button, %v", err)
+	}
+}
+
+func appendUnique(list []string, value string) []string {
+	for _, v := range list {
+		if v == value {
+			return list
+		}
+	}
+	return append(list, value)
+}
+
+// reply sends plain text so that urls and errors need no escaping
+func (b *TelegramBot) reply(chatID, text string) {
+	data := make(url.Values)
+	data["chat_id"] = []string{chatID}
+	data["text"] = []string{text}
+	data["disable_web_page_preview"] = []string{"true"}
+	if _, err := b.notifier.post("sendMessage", data); err != nil {
+		log.Errorf("Error replying to telegram command, %v", err)
+	}
+}
+
+func (b *TelegramBot) handleCommand(text string) string {
+	args := strings.Fields(text)
+	// commands in groups may be addressed as /cmd@botname
+	command := strings.SplitN(args[0], "@", 2)[0]
+	args = args[1:]
+	var reply string
+	var err error
+	switch command {
+	case "/add":
+		reply, err = b.add(args)
+	case "/remove", "/rm":
+		reply, err = b.remove(args)
+	case "/list", "/ls":
+		reply, err = b.list()
+	case "/mute":
+		reply, err = b.mute(args)
+	case "/unmute":
+		reply, err = b.unmute(args)
+	case "/status":
+		reply, err = b.status()
+	default:
+		err = fmt.Errorf("unknown command %s - try /add, /remove, /list, /mute, /unmute or /status", command)
+	}
+	if err != nil {
+		return "Error: " + err.Error()
+	}
+	return reply
+}
+
+// subscription is a feed along with the watch file it is in
+type subscription struct {
+	spec FeedSpec
+	file *WatchFile
+}
+
+func (b *TelegramBot) feeds() ([]subscription, error) {
+	var feeds []subscription
+	for _, fn := range b.files {
+		wf, err := LoadWatchFile(fn)
+		if err != nil {
+			return nil, err
+		}
+		for _, spec := range wf.Feeds() {
+			feeds = append(feeds, subscription{spec, wf})
+		}
+	}
+	return feeds, nil
+}
+
+// findFeed resolves a url, label or /list number to a feed
+func (b *TelegramBot) findFeed(ref string) (subscription, error) {
+	feeds, err := b.feeds()
+	if err != nil {
+		return subscription{}, err
+	}
+	if n, err := strconv.Atoi(ref); err == nil && n >= 1 && n <= len(feeds) {
+		return feeds[n-1], nil
+	}
+	for _, f := range feeds {
+		if f.spec.URL == ref || strings.EqualFold(f.spec.Opts["label"], ref) {
+			return f, nil
+		}
+	}
+	return subscription{}, fmt.Errorf("no feed matches %s", ref)
+}
+
+func (b *TelegramBot) add(args []string) (string, error) {
+	if len(args) == 0 {
+		return "", fmt.Errorf("usage: /add <url> [key=value ...]")
+	}
+	if len(b.files) == 0 {
+		return "", fmt.Errorf("no watch files to add to")
+	}
+	spec, err := parseWatchLine(strings.Join(args, " "))
+	if err != nil || spec == nil {
+		return "", fmt.Errorf("could not parse %s - %v", strings.Join(args, " "), err)
+	}
+	if err := checkRemoteFeed(*spec); err != nil {
+		return "", err
+	}
+	for _, fn := range b.files {
+		if wf, err := LoadWatchFile(fn); err == nil {
+			if _, exists := wf.Find(spec.URL); exists {
+				return "", fmt.Errorf("%s is already in %s", spec.URL, fn)
+			}
+		}
+	}
+	wf, err := LoadWatchFile(b.files[0])
+	if err != nil {
+		return "", err
+	}
+	if err := wf.Add(*spec); err != nil {
+		return "", err
+	}
+	if err := wf.Save(); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Added %s to %s", spec.URL, wf.Filename), nil
+}
+
+func (b *TelegramBot) remove(args []string) (string, error) {
+	if len(args) == 0 {
+		return "", fmt.Errorf("usage: /remove <feed>")
+	}
+	f, err := b.findFeed(strings.Join(args, " "))
+	if err != nil {
+		return "", err
+	}
+	f.file.Remove(f.spec.URL)
+	if err := f.file.Save(); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Removed %s from %s", f.spec.URL, f.file.Filename), nil
+}
+
+func (b *TelegramBot) list() (string, error) {
+	feeds, err := b.feeds()
+	if err != nil {
+		return "", err
+	}
+	if len(feeds) == 0 {
+		return "No feeds are monitored", nil
+	}
+	var sb strings.Builder
+	for i, f := range feeds {
+		fmt.Fprintf(&sb, "%d. %s", i+1, f.spec.URL)
+		if label := f.spec.Opts["label"]; label != "" {
+			fmt.Fprintf(&sb, " (%s)", label)
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String(), nil
+}
+
+func (b *TelegramBot) mute(args []string) (string, error) {
+	if len(args) < 2 {
+		return "", fmt.Errorf("usage: /mute <feed> <duration, e.g. 2h or 3d>")
+	}
+	f, err := b.findFeed(strings.Join(args[:len(args)-1], " "))
+	if err != nil {
+		return "", err
+	}
+	d, err := parseDuration(args[len(args)-1])
+	if err != nil || d <= 0 {
+		return "", fmt.Errorf("invalid duration %s", args[len(args)-1])
+	}
+	until := time.Now().Add(d)
+	MuteFeed(b.basedir, f.spec.URL, until)
+	return fmt.Sprintf("Muted %s until %s", f.spec.URL, until.Format("2006-01-02 15:04")), nil
+}
+
+func (b *TelegramBot) unmute(args []string) (string, error) {
+	if len(args) == 0 {
+		return "", fmt.Errorf("usage: /unmute <feed>")
+	}
+	f, err := b.findFeed(strings.Join(args, " "))
+	if err != nil {
+		return "", err
+	}
+	MuteFeed(b.basedir, f.spec.URL, time.Time{})
+	return fmt.Sprintf("Unmuted %s", f.spec.URL), nil
+}
+
+func (b *TelegramBot) status() (string, error) {
+	feeds, err := b.feeds()
+	if err != nil {
+		return "", err
+	}
+	if len(feeds) == 0 {
+		return "No feeds are monitored", nil
+	}
+	var sb strings.Builder
+	for i, f := range feeds {
+		state := LoadFeedState(b.basedir, f.spec.URL)
+		fmt.Fprintf(&sb, "%d. %s\n   last fetch: %s, last new item: %s, errors: %d",
+			i+1, f.spec.URL, formatStateTime(state.LastFetch), formatStateTime(state.LastNewItem), state.ErrorCount)
+		if state.Muted() {
+			fmt.Fprintf(&sb, ", muted until %s", state.MutedUntil.Format("2006-01-02 15:04"))
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String(), nil
+}
+
+func formatStateTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return t.Format("2006-01-02 15:04")
+}
+
+// parseDuration extends time.ParseDuration with a d suffix for days
+func parseDuration(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
@@ -0,0 +1,213 @@
+package feednotifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// fakeBotAPI is a minimal stand in for the telegram bot api that serves
+// queued updates and records sent messages
+type fakeBotAPI struct {
+	sync.Mutex
+	updates []telegramUpdate
+	sent    []map[string]string
+}
+
+func (f *fakeBotAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	r.ParseForm()
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/getUpdates"):
+		json.NewEncoder(w).Encode(telegramUpdates{Ok: true, Result: f.updates})
+		f.updates = nil
+	case strings.HasSuffix(r.URL.Path, "/sendMessage"), strings.HasSuffix(r.URL.Path, "/answerCallbackQuery"):
+		msg := make(map[string]string)
+		for k := range r.Form {
+			msg[k] = r.Form.Get(k)
+		}
+		f.sent = append(f.sent, msg)
+		fmt.Fprint(w, `{"ok":true}`)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeBotAPI) command(chatID int64, text string) {
+	f.Lock()
+	defer f.Unlock()
+	f.updates = append(f.updates, telegramUpdate{
+		UpdateID: int64(len(f.sent) + len(f.updates) + 1),
+		Message:  &telegramMessage{Chat: telegramChat{ID: chatID}, Text: text},
+	})
+}
+
+func (f *fakeBotAPI) lastReply() string {
+	f.Lock()
+	defer f.Unlock()
+	if len(f.sent) == 0 {
+		return ""
+	}
+	return f.sent[len(f.sent)-1]["text"]
+}
+
+func TestTelegramBotCommands(t *testing.T) {
+	api := &fakeBotAPI{}
+	ts := httptest.NewServer(api)
+	defer ts.Close()
+	defer func(tg string) { telegramAPI = tg }(telegramAPI)
+	telegramAPI = ts.URL
+
+	dir, _ := ioutil.TempDir("", "feednotifier")
+	defer os.RemoveAll(dir)
+	watchfile := filepath.Join(dir, "watch.txt")
+	ioutil.WriteFile(watchfile, []byte("# shows\nhttps://a.com/rss label=Alpha\n"), 0644)
+
+	bot := newTelegramBot(newTelegramNotifier("token", "42"), []string{watchfile}, dir, nil)
+	bot.allowed["42"] = true
+	bot.pollTimeout = 0
+	run := func(chatID int64, text string) string {
+		api.command(chatID, text)
+		if err := bot.poll(); err != nil {
+			t.Fatal(err)
+		}
+		return api.lastReply()
+	}
+
+	if reply := run(42, "/add https://b.com/rss tags=tv"); !strings.Contains(reply, "Added https://b.com/rss") {
+		t.Errorf("unexpected /add reply: %s", reply)
+	}
+	if reply := run(42, "/add exec:/bin/sh args=-c"); !strings.Contains(reply, "can only be added to the watch file") {
+		t.Errorf("expected /add of an exec feed to be refused, got %s", reply)
+	}
+	if reply := run(42, "/list"); reply != "1. https://a.com/rss (Alpha)\n2. https://b.com/rss\n" {
+		t.Errorf("unexpected /list reply: %q", reply)
+	}
+	if reply := run(42, "/mute alpha 2h"); !strings.Contains(reply, "Muted https://a.com/rss") {
+		t.Errorf("unexpected /mute reply: %s", reply)
+	}
+	if !LoadFeedState(dir, "https://a.com/rss").Muted() {
+		t.Errorf("feed should be muted")
+	}
+	if reply := run(42, "/status"); !strings.Contains(reply, "muted until") {
+		t.Errorf("unexpected /status reply: %s", reply)
+	}
+	if reply := run(42, "/remove 2"); !strings.Contains(reply, "Removed https://b.com/rss") {
+		t.Errorf("unexpected /remove reply: %s", reply)
+	}
+	content, _ := ioutil.ReadFile(watchfile)
+	if string(content) != "# shows\nhttps://a.com/rss label=Alpha\n" {
+		t.Errorf("unexpected watch file:\n%s", content)
+	}
+
+	sent := len(api.sent)
+	run(99, "/list")
+	if len(api.sent) != sent {
+		t.Errorf("commands from unauthorized chats should be ignored")
+	}
+	if bot.offset != 8 {
+		t.Errorf("expected offset to advance past handled updates, got %d", bot.offset)
+	}
+}
+
+func TestTelegramBotItemButtons(t *testing.T) {
+	api := &fakeBotAPI{}
+	ts := httptest.NewServer(api)
+	defer ts.Close()
+	defer func(tg string) { telegramAPI = tg }(telegramAPI)
+	telegramAPI = ts.URL
+	initTemplates()
+
+	dir, _ := ioutil.TempDir("", "feednotifier")
+	defer os.RemoveAll(dir)
+	n, _ := CreateNotifier("telegram:token#42#buttons")
+	item := &FeedItem{
+		Item:    &gofeed.Item{Title: "Modern.Family.S09E10.720p.HEVC", Link: "magnet:?xt=urn:btih:abc&dn=Modern.Family"},
+		FeedURL: "https://zooqle.com/rss",
+	}
+	if err := n.NotifyItem(item); err != nil {
+		t.Fatal(err)
+	}
+	var keyboard inlineKeyboard
+	json.Unmarshal([]byte(api.sent[0]["reply_markup"]), &keyboard)
+	if len(keyboard.InlineKeyboard) != 2 || keyboard.InlineKeyboard[0][0].CopyText == nil {
+		t.Fatalf("unexpected keyboard %s", api.sent[0]["reply_markup"])
+	}
+	never := keyboard.InlineKeyboard[1][2].CallbackData
+
+	bot := newTelegramBot(n.(*telegramNotifier), nil, dir, []string{"42"})
+	bot.pollTimeout = 0
+	api.Lock()
+	api.updates = append(api.updates, telegramUpdate{UpdateID: 1, CallbackQuery: &telegramCallbackQuery{
+		ID: "q1", Message: &telegramMessage{Chat: telegramChat{ID: 42}}, Data: never,
+	}})
+	api.Unlock()
+	bot.poll()
+	if reply := api.lastReply(); !strings.Contains(reply, "no longer be sent") {
+		t.Errorf("unexpected callback answer: %s", reply)
+	}
+	state := LoadFeedState(dir, "https://zooqle.com/rss")
+	if len(state.Exclude) != 1 || state.Exclude[0] != `(?i)\bmodern\W+family\W+s09e10` {
+		t.Errorf("expected exclude rule, got %v", state.Exclude)
+	}
+}
+
+func TestBotRefusesPatternsWithoutWords(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "feednotifier")
+	defer os.RemoveAll(dir)
+	b := &TelegramBot{basedir: dir}
+	feedURL := "https://zooqle.com/rss"
+	id := telegramActions.add(itemAction{FeedURL: feedURL, Title: "!!!"})
+	if reply := b.applyAction(actionNever + ":" + id); reply != "This title has no words to match" {
+		t.Errorf("unexpected reply %q", reply)
+	}
+	if state := loadState(feedURL, SavePath(dir, feedURL)); len(state.Exclude) != 0 {
+		t.Errorf("expected no exclude rule, got %v", state.Exclude)
+	}
+}
+
+func TestBotPollGivesUp(t *testing.T) {
+	done := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer ts.Close()
+	defer close(done)
+	defer func(tg string, margin time.Duration) { telegramAPI, pollMargin = tg, margin }(telegramAPI, pollMargin)
+	telegramAPI, pollMargin = ts.URL, 100*time.Millisecond
+
+	bot := newTelegramBot(newTelegramNotifier("bot", "42"), nil, "", nil)
+	bot.pollTimeout = 0
+	start := time.Now()
+	if err := bot.poll(); err == nil {
+		t.Fatal("expected the poll to time out")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the poll to stop after its deadline, took %v", elapsed)
+	}
+}
+
+func TestItemActionIDsAreUnique(t *testing.T) {
+	a := &itemActions{items: make(map[string]itemAction)}
+	for i := 0; i < 100; i++ {
+		a.add(itemAction{Title: strconv.Itoa(i)})
+	}
+	if len(a.items) != 100 {
+		t.Errorf("expected 100 distinct ids, got %d", len(a.items))
+	}
+}
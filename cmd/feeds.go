@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/raghur/feednotifier"
+)
+
+type watchFileOption struct {
+	File string `long:"file" required:"yes" description:"Watch file to operate on" value-name:"FEED-FILE"`
+}
+
+type feedUrlArg struct {
+	Args struct {
+		URL string `required:"yes" positional-arg-name:"URL"`
+	} `positional-args:"yes"`
+}
+
+type feedsAddCommand struct {
+	watchFileOption
+	feedUrlArg
+	Opts []string `short:"o" long:"opts" description:"Feed option in key=value form; can be specified multiple times" value-name:"KEY=VALUE"`
+}
+
+func (c *feedsAddCommand) Execute(args []string) error {
+	wf, err := feednotifier.LoadWatchFile(c.File)
+	if os.IsNotExist(err) {
+		wf, err = &feednotifier.WatchFile{Filename: c.File}, nil
+	}
+	if err != nil {
+		return err
+	}
+	spec := feednotifier.FeedSpec{URL: c.Args.URL, Opts: make(map[string]string)}
+	for _, o := range c.Opts {
+		kv := strings.SplitN(o, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return fmt.Errorf("invalid option %q - expected key=value", o)
+		}
+		spec.Opts[kv[0]] = kv[1]
+	}
+	if err := wf.Add(spec); err != nil {
+		return err
+	}
+	if err := wf.Save(); err != nil {
+		return err
+	}
+	fmt.Printf("Added %s\n", spec)
+	return nil
+}
+
+type feedsRmCommand struct {
+	watchFileOption
+	feedUrlArg
+}
+
+func (c *feedsRmCommand) Execute(args []string) error {
+	wf, err := feednotifier.LoadWatchFile(c.File)
+	if err != nil {
+		return err
+	}
+	if !wf.Remove(c.Args.URL) {
+		return fmt.Errorf("%s is not in %s", c.Args.URL, c.File)
+	}
+	if err := wf.Save(); err != nil {
+		return err
+	}
+	fmt.Printf("Removed %s\n", c.Args.URL)
+	return nil
+}
+
+type feedsLsCommand struct {
+	watchFileOption
+}
+
+func (c *feedsLsCommand) Execute(args []string) error {
+	wf, err := feednotifier.LoadWatchFile(c.File)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "URL\tSAVE PATH\tLAST FETCH\tLAST NEW ITEM\tERRORS")
+	for _, spec := range wf.Feeds() {
+		state := feednotifier.LoadFeedState(opts.WorkingDir, spec.URL)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\n", spec.URL, state.SavePath,
+			formatTime(state.LastFetch), formatTime(state.LastNewItem), state.ErrorCount)
+	}
+	return w.Flush()
+}
+
+type feedsShowCommand struct {
+	watchFileOption
+	feedUrlArg
+}
+
+func (c *feedsShowCommand) Execute(args []string) error {
+	wf, err := feednotifier.LoadWatchFile(c.File)
+	if err != nil {
+		return err
+	}
+	spec, found := wf.Find(c.Args.URL)
+	if !found {
+		return fmt.Errorf("%s is not in %s", c.Args.URL, c.File)
+	}
+	state := feednotifier.LoadFeedState(opts.WorkingDir, spec.URL)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "URL:\t%s\n", spec.URL)
+	for k, v := range spec.Opts {
+		fmt.Fprintf(w, "Option %s:\t%s\n", k, v)
+	}
+	fmt.Fprintf(w, "Save path:\t%s\n", state.SavePath)
+	fmt.Fprintf(w, "Last fetch:\t%s\n", formatTime(state.LastFetch))
+	fmt.Fprintf(w, "Last new item:\t%s\n", formatTime(state.LastNewItem))
+	fmt.Fprintf(w, "Errors:\t%d\n", state.ErrorCount)
+	if state.LastError != "" {
+		fmt.Fprintf(w, "Last error:\t%s\n", state.LastError)
+	}
+	return w.Flush()
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
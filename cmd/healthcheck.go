@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type healthcheckCommand struct {
+	URL     string        `long:"url" description:"Base url of the daemon; defaults to the --listen address on localhost" value-name:"URL"`
+	Timeout time.Duration `long:"timeout" default:"5s" description:"Timeout for each request" value-name:"DURATION"`
+}
+
+// Execute queries /healthz and /readyz and fails unless both are ok, so it
+// can be used as a Dockerfile HEALTHCHECK
+func (c *healthcheckCommand) Execute(args []string) error {
+	base := c.URL
+	if base == "" {
+		if opts.Listen == "" {
+			return fmt.Errorf("no daemon to check - pass --url or --listen")
+		}
+		host, port, err := net.SplitHostPort(opts.Listen)
+		if err != nil {
+			return fmt.Errorf("could not parse --listen %s - %v", opts.Listen, err)
+		}
+		if host == "" || host == "0.0.0.0" || host == "::" {
+			host = "localhost"
+		}
+		base = "http://" + net.JoinHostPort(host, port)
+	}
+	client := &http.Client{Timeout: c.Timeout}
+	failed := false
+	for _, endpoint := range []string{"/healthz", "/readyz"} {
+		resp, err := client.Get(strings.TrimSuffix(base, "/") + endpoint)
+		if err != nil {
+			fmt.Printf("FAIL %s: %v\n", endpoint, err)
+			failed = true
+			continue
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			fmt.Printf("FAIL %s: %s\n", endpoint, strings.TrimSpace(string(body)))
+			failed = true
+			continue
+		}
+		fmt.Printf("OK   %s\n", endpoint)
+	}
+	if failed {
+		return fmt.Errorf("daemon at %s is not healthy", base)
+	}
+	return nil
+}
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/jasonlvhit/gocron"
 	"github.com/jessevdk/go-flags"
@@ -12,36 +15,84 @@ import (
 )
 
 var opts struct {
-	LogLevel     string   `short:"l" long:"loglevel" default:"info" description:"Set log level" choice:"debug" choice:"info" choice:"warn" choice:"error" choice:"fatal" choice:"panic"`
-	Interval     uint64   `short:"i" long:"interval" default:"30" description:"interval between checks" value-name:"MINUTES"`
-	Logfile      string   `short:"f" long:"log" description:"log file" value-name:"FILE"`
-	Notifier     []string `short:"n" long:"notifier" required:"1" description:"Attach a notifier - format type:value, can be specified multiple times" value-name:"notifierspec"`
-	WorkingDir   string   `short:"w" long:"workingdir" default:"~/.feednotifier" description:"Working directory" value-name:"FOLDER"`
-	Templates    []string `short:"t" long:"template" description:"Go template file for message rendering; multiple; Use domain name as template name to override default template" value-name:"TEMPLATE"`
-	WatchedFiles struct {
-		Files []string `required:"yes" description:"Watched file(s) with RSS feeds - one feed per line" positional-arg-name:"FEED-FILE"`
-	} `positional-args:"yes"`
-	notifiers []feednotifier.Notifier
+	LogLevel     string        `short:"l" long:"loglevel" default:"info" description:"Set log level" choice:"debug" choice:"info" choice:"warn" choice:"error" choice:"fatal" choice:"panic"`
+	Interval     uint64        `short:"i" long:"interval" default:"30" description:"interval between checks" value-name:"MINUTES"`
+	Logfile      string        `short:"f" long:"log" description:"log file" value-name:"FILE"`
+	Notifier     []string      `short:"n" long:"notifier" description:"Attach a notifier - format type:value, can be specified multiple times; feed:[FOLDER][#file|#tag][#ITEMS] republishes items as Atom, RSS and JSON Feed per watch file or tag, written to FOLDER and served on /feeds/ with --web-user or --web-open" value-name:"notifierspec"`
+	WorkingDir   string        `short:"w" long:"workingdir" default:"~/.feednotifier" description:"Working directory" value-name:"FOLDER"`
+	Templates    []string      `short:"t" long:"template" description:"Go template file for message rendering; multiple; Use domain name as template name to override default template" value-name:"TEMPLATE"`
+	DryRun       bool          `long:"dry-run" description:"Download and diff feeds but print notifications to stdout instead of sending them; base files are not updated"`
+	TelegramBot  bool          `long:"telegram-bot" description:"Accept /add, /remove, /list, /mute, /unmute and /status commands and item buttons sent to telegram notifier bots"`
+	BotChats     []string      `long:"bot-chat" description:"Additional telegram chat id allowed to send bot commands; can be specified multiple times" value-name:"CHATID"`
+	Downloaders  []string      `short:"d" long:"download-client" description:"Define a bittorrent client feeds can send items to with download=NAME - format [NAME=]transmission:URL, [NAME=]qbittorrent:URL or [NAME=]watchdir:FOLDER; can be specified multiple times" value-name:"clientspec"`
+	Dedupe       string        `long:"dedupe" description:"Send an item only once across all feeds - comma separated keys identifying an item: link, infohash, title" value-name:"KEYS"`
+	DedupeWindow time.Duration `long:"dedupe-window" default:"72h" description:"How long a sent item suppresses its duplicates" value-name:"DURATION"`
+	MaxItems     int           `long:"max-items-per-run" description:"Send at most this many of the latest new items of a feed per check; 0 sends all. Feeds can override it with max-items-per-run=N" value-name:"N"`
+	MaxAge       int           `long:"max-age" description:"Ignore new items published more than this many days ago; 0 disables. Feeds can override it with max-age=N" value-name:"DAYS"`
+	Listen       string        `long:"listen" description:"Serve prometheus metrics on /metrics, health checks on /healthz and /readyz and, with --web-user or --web-open, the dashboard on /, the api and feed notifiers on /feeds/ at this address, e.g. :9090" value-name:"ADDR"`
+	WebUser      string        `long:"web-user" description:"Require basic auth with this user for the dashboard, api and /feeds/" value-name:"USER"`
+	WebPassword  string        `long:"web-password" description:"Password for --web-user; required with it" value-name:"PASSWORD"`
+	WebOpen      bool          `long:"web-open" description:"Serve the dashboard and api without --web-user; anyone reaching --listen can then change feeds and send items"`
+	AllowLocal   bool          `long:"allow-local-feeds" description:"Let the api and telegram bot add exec:, file:// and dir:// feeds, which run commands and read files on this machine; otherwise they can only be added to watch files"`
+	HTTPTimeout  time.Duration `long:"http-timeout" description:"Give up on a feed request after this long, including reading the response; default 2m. Feeds can override it with timeout=DURATION" value-name:"DURATION"`
+	HTTPConnect  time.Duration `long:"http-connect-timeout" description:"Give up connecting to a feed server after this long; default 30s. Feeds can override it with connect-timeout=DURATION" value-name:"DURATION"`
+	Proxy        string        `long:"proxy" description:"http, https or socks5 proxy url for feed requests; none disables the HTTP_PROXY and HTTPS_PROXY environment. Feeds can override it with proxy=URL" value-name:"URL"`
+	CAFile       string        `long:"ca-file" description:"PEM file with certificates trusted besides the system ones. Feeds can override it with ca=FILE" value-name:"FILE"`
+	Insecure     bool          `long:"insecure-skip-verify" description:"Don't verify the certificates of feed servers. Feeds can set insecure=true instead"`
+	Headers      []string      `long:"header" description:"Header sent with requests to --header-host, e.g. \"Authorization: Bearer TOKEN\"; can be specified multiple times. Feeds add headers with header.NAME=VALUE" value-name:"HEADER"`
+	Cookies      []string      `long:"cookie" description:"Cookie sent with requests to --header-host; can be specified multiple times. Feeds add cookies with cookie.NAME=VALUE" value-name:"NAME=VALUE"`
+	HeaderHosts  []string      `long:"header-host" description:"Host that --header and --cookie are sent to, e.g. *.example.com; can be specified multiple times and is required with them" value-name:"PATTERN"`
+	UserAgent    string        `long:"user-agent" description:"User agent of feed requests; defaults to a firefox one. Feeds can override it with user-agent=UA" value-name:"UA"`
+	notifiers    []feednotifier.Notifier
+	watchedFiles []string // Watched file(s) with RSS feeds - one feed per line
+	templatesErr error
 	// Make sure to keep this as the last option - ordering of fields in this struct matters.
 	Config func(string) `short:"c" long:"config" description:"ini formatted config file" default:"~/.feednotifier/feednotifier.ini" value-name:"CONFIG"`
 }
 
+// command is the subcommand selected on the command line, if any
+var command flags.Commander
+
 func main() {
-	parseOptions(os.Args[1:])
+	args := parseOptions(os.Args[1:])
+	if command != nil {
+		if err := command.Execute(args); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
 	log.Info("/////////////////////////////////////////////////////////////")
 	log.Info("****************** *Process Started* ************************")
 	log.Info("/////////////////////////////////////////////////////////////")
 	log.Infof("Feeds will be monitored every: %v mins", opts.Interval)
 	log.Infof("New items will be published to: %v", opts.notifiers)
-	log.Infof("watching files: %v", opts.WatchedFiles.Files)
-	for _, file := range opts.WatchedFiles.Files {
+	log.Infof("watching files: %v", opts.watchedFiles)
+	if opts.Listen != "" {
+		feednotifier.StartServer(opts.Listen)
+	}
+	for _, file := range opts.watchedFiles {
 		watcher := feednotifier.NewMonitoredFile(file, opts.Interval, &opts.notifiers, opts.WorkingDir)
 		watcher.Start()
 	}
+	if opts.TelegramBot && !opts.DryRun {
+		feednotifier.StartTelegramBots(opts.notifiers, opts.watchedFiles, opts.WorkingDir, opts.BotChats)
+	}
 	<-gocron.Start()
 	log.Debugf("Completed process")
 }
 
+func addCommands(parser *flags.Parser) {
+	feeds, _ := parser.AddCommand("feeds", "Manage subscriptions", "Add, remove and inspect the feeds in a watch file", &struct{}{})
+	feeds.AddCommand("add", "Add a feed", "Append a feed url to the watch file", &feedsAddCommand{})
+	feeds.AddCommand("rm", "Remove a feed", "Remove a feed url from the watch file", &feedsRmCommand{})
+	feeds.AddCommand("ls", "List feeds", "List the feeds in the watch file with their fetch status", &feedsLsCommand{})
+	feeds.AddCommand("show", "Show a feed", "Show the options and fetch status of a feed", &feedsShowCommand{})
+	parser.AddCommand("render", "Preview a template", "Render a feed item with the template that would be selected for it", &renderCommand{})
+	parser.AddCommand("healthcheck", "Check a running daemon", "Query /healthz and /readyz of a daemon started with --listen; exits non-zero unless both are ok", &healthcheckCommand{})
+	parser.AddCommand("test-notifier", "Validate notifiers", "Parse each -n notifier spec, check its credentials and optionally send a sample item", &testNotifierCommand{})
+}
+
 func parseIniIfFound(file string, parser *flags.Parser) {
 	log.Debugf("Start parsing ini file %s", file)
 	iniParser := flags.NewIniParser(parser)
@@ -59,6 +110,13 @@ func parseIniIfFound(file string, parser *flags.Parser) {
 
 func parseOptions(args []string) []string {
 	parser := flags.NewParser(&opts, flags.Default)
+	parser.Usage = "[OPTIONS] [FEED-FILE...]"
+	parser.SubcommandsOptional = true
+	parser.CommandHandler = func(cmd flags.Commander, args []string) error {
+		command = cmd
+		return nil
+	}
+	addCommands(parser)
 	opts.Config = func(file string) {
 		parseIniIfFound(file, parser)
 	}
@@ -71,19 +129,77 @@ func parseOptions(args []string) []string {
 		}
 		os.Exit(1)
 	}
+	if command == nil {
+		if len(args) == 0 || len(opts.Notifier) == 0 {
+			fmt.Fprintln(os.Stderr, "at least one notifier and one FEED-FILE are required")
+			parser.WriteHelp(os.Stdout)
+			os.Exit(1)
+		}
+		opts.watchedFiles = args
+	}
 	initLog(opts.LogLevel, opts.Logfile)
-	feednotifier.ParseCustomTemplates(opts.Templates)
+	opts.templatesErr = feednotifier.ParseCustomTemplates(opts.Templates)
 	opts.WorkingDir, _ = homedir.Expand(opts.WorkingDir)
 	log.Debugf("Working directory: %s", opts.WorkingDir)
 	// log.Debugf("Now parsing notifiers %v", len(opts.Notifier))
 	opts.notifiers = make([]feednotifier.Notifier, 0, 5)
+	feednotifier.SetListening(opts.Listen != "")
+	if opts.Listen != "" {
+		// set before notifiers are checked; feed notifiers depend on them
+		if err := feednotifier.SetWebAuth(opts.WebUser, opts.WebPassword); err != nil {
+			log.Fatalf("Error in web options - %v", err)
+		}
+		feednotifier.SetWebOpen(opts.WebOpen)
+	}
+	feednotifier.SetAllowLocalFeeds(opts.AllowLocal)
+	caFile, _ := homedir.Expand(opts.CAFile)
+	err = feednotifier.SetHTTPOptions(feednotifier.HTTPOptions{
+		Timeout:        opts.HTTPTimeout,
+		ConnectTimeout: opts.HTTPConnect,
+		Proxy:          opts.Proxy,
+		CAFile:         caFile,
+		Insecure:       opts.Insecure,
+		UserAgent:      opts.UserAgent,
+		Headers:        opts.Headers,
+		Cookies:        opts.Cookies,
+		HeaderHosts:    opts.HeaderHosts,
+	})
+	if err != nil {
+		log.Fatalf("Error parsing http options - %v", err)
+	}
+	if command != nil {
+		// commands create the notifiers they need themselves
+		return args
+	}
 	for _, no := range opts.Notifier {
 		notifier, err := feednotifier.CreateNotifier(no)
 		if err != nil {
 			log.Fatalf("Error parsing notifier - %v", err)
 		}
+		// feed notifiers are checked up front as they only write locally
+		if strings.HasPrefix(no, "feed:") {
+			if err := notifier.Validate(); err != nil {
+				log.Fatalf("Error in feed notifier - %v", err)
+			}
+		}
+		if opts.DryRun {
+			notifier = feednotifier.NewDryRunNotifier(notifier, os.Stdout)
+		}
 		opts.notifiers = append(opts.notifiers, notifier)
 	}
+	feednotifier.SetItemLimits(opts.MaxItems, opts.MaxAge)
+	if opts.Dedupe != "" {
+		if err := feednotifier.SetDedupe(strings.Split(opts.Dedupe, ","), opts.DedupeWindow); err != nil {
+			log.Fatalf("Error parsing dedupe options - %v", err)
+		}
+	}
+	for _, spec := range opts.Downloaders {
+		if err := feednotifier.RegisterDownloadClient(spec); err != nil {
+			log.Fatalf("Error parsing download client - %v", err)
+		}
+	}
+	feednotifier.SetDryRun(opts.DryRun)
+	feednotifier.MarkNotifiersReady(len(opts.notifiers))
 	return args
 }
 
@@ -104,6 +220,9 @@ func initLog(levelname, logfilename string) {
 			log.Panicf("Unable to open log file, bailing %v", e)
 		}
 		log.SetOutput(logfile)
+	} else if command != nil {
+		// keep stdout for the command's own output
+		log.SetOutput(os.Stderr)
 	} else {
 		log.SetOutput(os.Stdout)
 	}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/raghur/feednotifier"
+)
+
+type renderCommand struct {
+	Feed     string `long:"feed" required:"yes" description:"Feed url or local feed file to take the item from" value-name:"URL-OR-FILE"`
+	Saved    bool   `long:"saved" description:"Use the base file saved in the working directory for the --feed url instead of downloading it"`
+	URL      string `long:"url" description:"Feed url used to select the template when --feed is a local file" value-name:"URL"`
+	Item     int    `long:"item" default:"0" description:"Index of the feed item to render" value-name:"N"`
+	Notifier string `long:"notifier" choice:"telegram" choice:"pushover" description:"Render with this notifier type's templates and show the other fields it sends"`
+	Format   string `long:"format" choice:"text" choice:"markdown" choice:"markdownv2" choice:"html" description:"Output format to escape for; defaults to the notifier's default format"`
+}
+
+func (c *renderCommand) Execute(args []string) error {
+	if opts.templatesErr != nil {
+		return fmt.Errorf("could not load templates - %v", opts.templatesErr)
+	}
+	feed, furl, err := c.loadFeed()
+	if err != nil {
+		return err
+	}
+	if c.Item < 0 || c.Item >= len(feed.Items) {
+		return fmt.Errorf("feed %s has %d items; --item %d is out of range", c.Feed, len(feed.Items), c.Item)
+	}
+	item := &feednotifier.FeedItem{Item: feed.Items[c.Item], Feed: feed, FeedURL: furl}
+	item.Episode = feednotifier.ParseEpisode(item.Title)
+	format := c.Format
+	if format == "" && c.Notifier == "telegram" {
+		format = "markdown"
+	}
+	if format == "text" {
+		format = ""
+	}
+	templateName, text, err := feednotifier.RenderItem(c.Notifier, format, item)
+	fmt.Printf("Feed:     %s\n", feed.Title)
+	fmt.Printf("Item:     %d of %d - %s\n", c.Item, len(feed.Items), item.Title)
+	fmt.Printf("Template: %s\n", templateName)
+	fmt.Printf("Format:   %s\n", defaultString(format, "text"))
+	if err != nil {
+		return fmt.Errorf("rendering failed - %v", err)
+	}
+	switch c.Notifier {
+	case "pushover":
+		fmt.Printf("title:     %s\nurl:       %s\nurl_title: Add this torrent\n", item.Title, item.Link)
+		if format == "html" {
+			fmt.Println("html:      1")
+		}
+	case "telegram":
+		fmt.Printf("parse_mode: %s\n", format)
+	}
+	fmt.Println("----")
+	fmt.Println(text)
+	return nil
+}
+
+// loadFeed returns the parsed feed and the url used to select its template
+func (c *renderCommand) loadFeed() (*gofeed.Feed, string, error) {
+	furl := c.URL
+	if furl == "" {
+		furl = c.Feed
+	}
+	if u, err := url.Parse(c.Feed); err == nil && (u.Scheme == "http" || u.Scheme == "https") && !c.Saved {
+		feed, err := feednotifier.FetchFeed(c.Feed)
+		return feed, furl, err
+	}
+	fn := c.Feed
+	if c.Saved {
+		fn = feednotifier.SavePath(opts.WorkingDir, c.Feed)
+	}
+	fh, err := os.Open(fn)
+	if err != nil {
+		return nil, furl, err
+	}
+	defer fh.Close()
+	feed, err := feednotifier.ParseFeed(fh)
+	if err != nil {
+		return nil, furl, fmt.Errorf("could not parse feed %s - %v", fn, err)
+	}
+	return feed, furl, nil
+}
+
+func defaultString(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/raghur/feednotifier"
+)
+
+type testNotifierCommand struct {
+	Feed string `long:"feed" description:"Send a sample item from this feed url through each notifier" value-name:"URL"`
+	Item int    `long:"item" default:"0" description:"Index of the feed item to send" value-name:"N"`
+}
+
+func (c *testNotifierCommand) Execute(args []string) error {
+	if len(opts.Notifier) == 0 {
+		return fmt.Errorf("no notifiers to test - pass one or more with -n")
+	}
+	var item *feednotifier.FeedItem
+	if c.Feed != "" {
+		feed, err := feednotifier.FetchFeed(c.Feed)
+		if err != nil {
+			return fmt.Errorf("could not fetch sample feed %s - %v", c.Feed, err)
+		}
+		if c.Item < 0 || c.Item >= len(feed.Items) {
+			return fmt.Errorf("feed %s has %d items; --item %d is out of range", c.Feed, len(feed.Items), c.Item)
+		}
+		item = &feednotifier.FeedItem{Item: feed.Items[c.Item], Feed: feed, FeedURL: c.Feed}
+		item.Episode = feednotifier.ParseEpisode(item.Title)
+	}
+	failed := 0
+	for i, spec := range opts.Notifier {
+		// never echo the spec itself - it holds credentials
+		name := fmt.Sprintf("#%d %s", i+1, strings.SplitN(spec, ":", 2)[0])
+		notifier, err := feednotifier.CreateNotifier(spec)
+		if err != nil {
+			fmt.Printf("FAIL %s: %v\n", name, err)
+			failed++
+			continue
+		}
+		if err := notifier.Validate(); err != nil {
+			fmt.Printf("FAIL %s: %v\n", name, err)
+			failed++
+			continue
+		}
+		if item != nil {
+			if err := notifier.NotifyItem(item); err != nil {
+				fmt.Printf("FAIL %s: credentials ok but sending sample item failed: %v\n", name, err)
+				failed++
+				continue
+			}
+			fmt.Printf("OK   %s: sent %q\n", name, item.Title)
+			continue
+		}
+		fmt.Printf("OK   %s\n", name)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d notifiers failed", failed, len(opts.Notifier))
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package feednotifier
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/raghur/feednotifier/static"
+	log "github.com/sirupsen/logrus"
+)
+
+// monitored holds every MonitoredFile so the web ui can list and check them
+var monitored struct {
+	sync.Mutex
+	files []*MonitoredFile
+}
+
+func registerMonitoredFile(mf *MonitoredFile) {
+	monitored.Lock()
+	defer monitored.Unlock()
+	monitored.files = append(monitored.files, mf)
+}
+
+func monitoredFiles() []*MonitoredFile {
+	monitored.Lock()
+	defer monitored.Unlock()
+	return append([]*MonitoredFile{}, monitored.files...)
+}
+
+var webUser, webPassword string
+
+// webOpen serves the dashboard and api to anyone when no user is set
+var webOpen bool
+
+// SetWebAuth protects the dashboard with basic auth. A user without a
+// password is refused as it would let anyone in.
+func SetWebAuth(user, password string) error {
+	if user != "" && password == "" {
+		return fmt.Errorf("web user %s needs a password", user)
+	}
+	webUser, webPassword = user, password
+	return nil
+}
+
+// SetWebOpen allows the dashboard and api without a user. They can add feeds
+// and send items, so they are disabled by default.
+func SetWebOpen(open bool) {
+	webOpen = open
+}
+
+// private serves h with basicAuth, or not at all when there is no user and
+// the web interface was not explicitly opened
+func private(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if webUser == "" && !webOpen {
+			http.Error(w, "The dashboard and api are disabled - set --web-user or --web-open", http.StatusForbidden)
+			return
+		}
+		basicAuth(h).ServeHTTP(w, r)
+	})
+}
+
+// csrfToken is put in the dashboard's forms and changes on every start, so
+// other sites can't post them
+var csrfToken = newCSRFToken()
+
+func newCSRFToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		log.Fatalf("Could not create csrf token, %v", err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// basicAuth requires the configured user and password, if any
+func basicAuth(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if webUser != "" {
+			user, password, ok := r.BasicAuth()
+			if !ok || subtle.ConstantTimeCompare([]byte(user), []byte(webUser)) != 1 ||
+				subtle.ConstantTimeCompare([]byte(password), []byte(webPassword)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Basic realm="feednotifier"`)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// recentOnDashboard is how many recent items are listed per feed
+const recentOnDashboard = 5
+
+type dashboardFeed struct {
+	URL    string
+	Label  string
+	State  FeedState
+	Muted  bool
+	Recent []RecentItem
+}
+
+type dashboardFile struct {
+	Filename string
+	Interval uint64
+	NextRun  time.Time
+	Feeds    []dashboardFeed
+}
+
+func dashboardData() []dashboardFile {
+	var files []dashboardFile
+	for _, mf := range monitoredFiles() {
+		mf.lock.RLock()
+		file := dashboardFile{Filename: mf.filename, Interval: mf.interval, NextRun: mf.nextRun}
+		mf.lock.RUnlock()
+		for _, value := range mf.feeds() {
+			state := loadState(value.url, value.savePath)
+			recent := state.Recent
+			if len(recent) > recentOnDashboard {
+				recent = recent[:recentOnDashboard]
+			}
+			file.Feeds = append(file.Feeds, dashboardFeed{
+				URL:    value.url,
+				Label:  value.opts["label"],
+				State:  state,
+				Muted:  state.Muted(),
+				Recent: recent,
+			})
+		}
+		files = append(files, file)
+	}
+	return files
+}
+
+var dashboardFuncs = template.FuncMap{
+	"when": func(t time.Time) string {
+		if t.IsZero() {
+			return "never"
+		}
+		return t.Format("2006-01-02 15:04:05")
+	},
+	// link passes magnet links, which html/template replaces as an unsafe
+	// scheme, and leaves other links to be filtered as usual
+	"link": func(link string) interface{} {
+		if strings.HasPrefix(strings.ToLower(link), "magnet:") {
+			return template.URL(link)
+		}
+		return link
+	},
+}
+
+func dashboardHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	text, err := static.ReadFile("assets/web/dashboard.html")
+	if err != nil {
+		log.Errorf("Could not read dashboard template, %v", err)
+		http.Error(w, "dashboard unavailable", http.StatusInternalServerError)
+		return
+	}
+	t, err := template.New("dashboard").Funcs(dashboardFuncs).Parse(string(text))
+	if err != nil {
+		log.Errorf("Could not parse dashboard template, %v", err)
+		http.Error(w, "dashboard unavailable", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	data := struct {
+		Files []dashboardFile
+		CSRF  string
+	}{dashboardData(), csrfToken}
+	if err := t.Execute(w, data); err != nil {
+		log.Errorf("Error rendering dashboard, %v", err)
+	}
+}
+
+// checkHandler runs processLine for the posted feed url and returns to the
+// dashboard
+func checkHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.PostFormValue("csrf")), []byte(csrfToken)) != 1 {
+		http.Error(w, "invalid form, reload the dashboard", http.StatusForbidden)
+		return
+	}
+	feedURL := r.FormValue("url")
+	found := false
+	for _, mf := range monitoredFiles() {
+		if mf.CheckNow(feedURL) {
+			found = true
+		}
+	}
+	if !found {
+		http.Error(w, "feed is not monitored", http.StatusNotFound)
+		return
+	}
+	http.Redirect(w, r, "./", http.StatusSeeOther)
+}
@@ -0,0 +1,100 @@
+package feednotifier
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func TestDashboard(t *testing.T) {
+	initTemplates()
+	current := "test/zooqle.first.xml"
+	feed := serveFile(&current)
+	defer feed.Close()
+	dir, _ := ioutil.TempDir("", "feednotifier")
+	defer os.RemoveAll(dir)
+	defer func(files []*MonitoredFile) { monitored.files = files }(monitored.files)
+	defer SetWebAuth("", "")
+
+	notifiers := []Notifier{NewDryRunNotifier(newPushover("abc", "def"), &bytes.Buffer{})}
+	value := FeedUrl{url: feed.URL, savePath: SavePath(dir, feed.URL), basedir: dir, opts: map[string]string{"label": "Zooqle TV"}}
+	mf := &MonitoredFile{filename: "watch.txt", urls: map[string]FeedUrl{feed.URL: value}, interval: 30, notifiers: &notifiers, basedir: dir}
+	registerMonitoredFile(mf)
+	updateState(feed.URL, value.savePath, func(s *FeedState) {
+		s.recordFetch(&statusError{code: 503, status: "503 Service Unavailable"})
+		s.recordSent([]*FeedItem{
+			newFeedItem(nil, &gofeed.Item{Title: "Modern.Family.S09E10", Link: "https://zooqle.com/1"}, value),
+			newFeedItem(nil, &gofeed.Item{Title: "Modern.Family.S09E11", Link: testMagnet}, value),
+		})
+	})
+
+	ts := httptest.NewServer(newServeMux())
+	defer ts.Close()
+	for _, path := range []string{"/", "/api/feeds"} {
+		resp, _ := http.Get(ts.URL + path)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("expected %s to be disabled without a user, got %d", path, resp.StatusCode)
+		}
+	}
+	if err := SetWebAuth("admin", ""); err == nil {
+		t.Errorf("expected a user without a password to be refused")
+	}
+	SetWebAuth("admin", "secret")
+	resp, _ := http.Get(ts.URL + "/")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected dashboard to require auth, got %d", resp.StatusCode)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/", nil)
+	req.SetBasicAuth("admin", "secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	for _, want := range []string{"Zooqle TV", feed.URL, ">503<", "Modern.Family.S09E10", `href="magnet:?xt=urn:btih:abc`, "Check now"} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("expected %q on dashboard", want)
+		}
+	}
+
+	if !strings.Contains(string(body), csrfToken) {
+		t.Errorf("expected the csrf token in the check form")
+	}
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	check := func(token string) int {
+		form := url.Values{"url": {feed.URL}, "csrf": {token}}
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+"/check", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth("admin", "secret")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := check("forged"); code != http.StatusForbidden {
+		t.Errorf("expected a check without the csrf token to be refused, got %d", code)
+	}
+	if code := check(csrfToken); code != http.StatusSeeOther {
+		t.Errorf("expected redirect after check, got %d", code)
+	}
+	for i := 0; i < 50 && LoadFeedState(dir, feed.URL).LastStatus != http.StatusOK; i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if state := LoadFeedState(dir, feed.URL); state.LastStatus != http.StatusOK || state.ErrorCount != 0 {
+		t.Errorf("expected check now to fetch the feed, got status %d", state.LastStatus)
+	}
+}
@@ -0,0 +1,210 @@
+package feednotifier
+
+import (
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// dedupe keys
+const (
+	dedupeLink     = "link"
+	dedupeInfoHash = "infohash"
+	dedupeTitle    = "title"
+)
+
+var (
+	dedupeKeys   []string
+	dedupeWindow = 72 * time.Hour
+)
+
+// SetDedupe turns on suppression of items already sent by any feed within
+// window. keys lists what identifies an item - link, infohash and/or title;
+// an item matching a sent item on any key is a duplicate.
+func SetDedupe(keys []string, window time.Duration) error {
+	for _, key := range keys {
+		switch key {
+		case dedupeLink, dedupeInfoHash, dedupeTitle:
+		default:
+			return fmt.Errorf("Unknown dedupe key - %s: expected link, infohash or title", key)
+		}
+	}
+	if window <= 0 {
+		return fmt.Errorf("dedupe window must be positive, got %v", window)
+	}
+	dedupeKeys, dedupeWindow = keys, window
+	return nil
+}
+
+var trackingParam = regexp.MustCompile(`^(utm_.*|fbclid|gclid|ref)$`)
+
+// normalizeLink lowercases scheme and host, drops fragments, tracking
+// parameters and trailing slashes and sorts the query so mirrors of the
+// same link compare equal
+func normalizeLink(link string) string {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil || u.Scheme == "magnet" || u.Host == "" {
+		return strings.TrimSpace(link)
+	}
+	query := u.Query()
+	for param := range query {
+		if trackingParam.MatchString(param) {
+			query.Del(param)
+		}
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Host), "www.")
+	normalized := host + strings.TrimSuffix(u.EscapedPath(), "/")
+	if len(query) > 0 {
+		// Encode sorts parameters by name
+		normalized += "?" + query.Encode()
+	}
+	return normalized
+}
+
+var btih = regexp.MustCompile(`(?i)urn:btih:([0-9a-f]{40}|[a-z2-7]{32})\b`)
+
+// infoHash returns the lowercase hex infohash of the item's torrent, or ""
+func infoHash(item *FeedItem) string {
+	if hash := item.Ext("torrent", "infoHash"); len(hash) == 40 {
+		return strings.ToLower(hash)
+	}
+	for _, link := range []string{item.Link, item.Ext("torrent", "magnetURI")} {
+		m := btih.FindStringSubmatch(link)
+		if m == nil {
+			continue
+		}
+		if len(m[1]) == 40 {
+			return strings.ToLower(m[1])
+		}
+		if raw, err := base32.StdEncoding.DecodeString(strings.ToUpper(m[1])); err == nil {
+			return hex.EncodeToString(raw)
+		}
+	}
+	return ""
+}
+
+// titleHash hashes the words of a title, ignoring case and punctuation
+func titleHash(title string) string {
+	words := strings.Fields(strings.ToLower(nonWord.ReplaceAllString(title, " ")))
+	if len(words) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%x", sha1.Sum([]byte(strings.Join(words, " "))))
+}
+
+// itemKeys returns the configured dedupe keys of an item, prefixed by kind
+func itemKeys(item *FeedItem) []string {
+	var keys []string
+	for _, kind := range dedupeKeys {
+		var key string
+		switch kind {
+		case dedupeLink:
+			key = normalizeLink(item.Link)
+		case dedupeInfoHash:
+			key = infoHash(item)
+		case dedupeTitle:
+			key = titleHash(item.Title)
+		}
+		if key != "" {
+			keys = append(keys, kind+":"+key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// seenLock serialises updates to the seen items file, which is shared by
+// all feeds under a working directory
+var seenLock sync.Mutex
+
+func seenPath(basedir string) string {
+	return filepath.Join(basedir, "seen.json")
+}
+
+func loadSeen(basedir string) map[string]time.Time {
+	seen := make(map[string]time.Time)
+	content, err := ioutil.ReadFile(seenPath(basedir))
+	if err == nil {
+		if err = json.Unmarshal(content, &seen); err != nil {
+			log.Warnf("Ignoring corrupt seen items file in %s - %v", basedir, err)
+		}
+	}
+	return seen
+}
+
+func saveSeen(basedir string, seen map[string]time.Time) {
+	if dryRun {
+		return
+	}
+	for key, sent := range seen {
+		if time.Since(sent) > dedupeWindow {
+			delete(seen, key)
+		}
+	}
+	content, _ := json.MarshalIndent(seen, "", "  ")
+	os.MkdirAll(basedir, os.ModePerm)
+	if err := ioutil.WriteFile(seenPath(basedir), content, 0644); err != nil {
+		log.Errorf("Unable to save seen items file in %s, %v", basedir, err)
+	}
+}
+
+// dedupeItems drops items that any feed already sent within the dedupe
+// window, or that repeat an earlier item of the batch. Keys are only
+// remembered once items are sent, by recordSeen.
+func dedupeItems(items []*FeedItem, value FeedUrl) []*FeedItem {
+	if len(dedupeKeys) == 0 {
+		return items
+	}
+	seenLock.Lock()
+	seen := loadSeen(value.basedir)
+	seenLock.Unlock()
+	kept := items[:0]
+	for _, item := range items {
+		keys := itemKeys(item)
+		duplicate := ""
+		for _, key := range keys {
+			if sent, ok := seen[key]; ok && time.Since(sent) <= dedupeWindow {
+				duplicate = key
+				break
+			}
+		}
+		if duplicate != "" {
+			log.Infof("Skipping duplicate item %s from feed %s - %s", item.Title, value.url, duplicate)
+			continue
+		}
+		for _, key := range keys {
+			seen[key] = time.Now()
+		}
+		kept = append(kept, item)
+	}
+	return kept
+}
+
+// recordSeen remembers the keys of sent items for dedupeItems
+func recordSeen(items []*FeedItem, value FeedUrl) {
+	if len(dedupeKeys) == 0 || len(items) == 0 {
+		return
+	}
+	seenLock.Lock()
+	defer seenLock.Unlock()
+	seen := loadSeen(value.basedir)
+	for _, item := range items {
+		for _, key := range itemKeys(item) {
+			seen[key] = time.Now()
+		}
+	}
+	saveSeen(value.basedir, seen)
+}
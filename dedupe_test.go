@@ -0,0 +1,96 @@
+package feednotifier
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	ext "github.com/mmcdole/gofeed/extensions"
+)
+
+func TestNormalizeLink(t *testing.T) {
+	tests := []struct {
+		a, b string
+	}{
+		{"https://www.Zooqle.com/show/1/?utm_source=rss#top", "http://zooqle.com/show/1"},
+		{"https://example.com/t?id=1&cat=2", "https://example.com/t?cat=2&id=1"},
+	}
+	for _, test := range tests {
+		if a, b := normalizeLink(test.a), normalizeLink(test.b); a != b {
+			t.Errorf("expected %s and %s to match, got %s and %s", test.a, test.b, a, b)
+		}
+	}
+	if normalizeLink("https://example.com/t?id=1") == normalizeLink("https://example.com/t?id=2") {
+		t.Errorf("expected different queries to stay different")
+	}
+}
+
+func TestInfoHash(t *testing.T) {
+	hex := "c12fe1c06bba254a9dc9f519b335aa7c1367a88a"
+	tests := []*FeedItem{
+		{Item: &gofeed.Item{Link: "magnet:?xt=urn:btih:C12FE1C06BBA254A9DC9F519B335AA7C1367A88A&dn=x"}},
+		{Item: &gofeed.Item{Link: "magnet:?xt=urn:btih:YEX6DQDLXISUVHOJ6UM3GNNKPQJWPKEK"}},
+		{Item: &gofeed.Item{Link: "https://example.com/1", Extensions: ext.Extensions{
+			"torrent": {"infoHash": {{Name: "infoHash", Value: hex}}},
+		}}},
+	}
+	for _, item := range tests {
+		if hash := infoHash(item); hash != hex {
+			t.Errorf("%s: expected %s, got %s", item.Link, hex, hash)
+		}
+	}
+	if hash := infoHash(&FeedItem{Item: &gofeed.Item{Link: "https://example.com/1"}}); hash != "" {
+		t.Errorf("expected no infohash, got %s", hash)
+	}
+}
+
+func TestDedupeItems(t *testing.T) {
+	defer func(keys []string, window time.Duration) { dedupeKeys, dedupeWindow = keys, window }(dedupeKeys, dedupeWindow)
+	if err := SetDedupe([]string{"link", "bogus"}, time.Hour); err == nil {
+		t.Errorf("expected error for unknown dedupe key")
+	}
+	if err := SetDedupe([]string{"infohash", "title"}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	dir, _ := ioutil.TempDir("", "feednotifier")
+	defer os.RemoveAll(dir)
+	zooqle := FeedUrl{url: "https://zooqle.com/rss", basedir: dir}
+	mirror := FeedUrl{url: "https://zooqle.mirror/rss", basedir: dir}
+	item := func(value FeedUrl, title, link string) *FeedItem {
+		return newFeedItem(nil, &gofeed.Item{Title: title, Link: link}, value)
+	}
+
+	kept := dedupeItems([]*FeedItem{
+		item(zooqle, "Modern.Family.S09E10.720p", "magnet:?xt=urn:btih:c12fe1c06bba254a9dc9f519b335aa7c1367a88a"),
+		item(zooqle, "Some Movie 2019", "https://zooqle.com/movie"),
+	}, zooqle)
+	if len(kept) != 2 {
+		t.Fatalf("expected both items from the first feed, got %v", itemTitles(kept))
+	}
+	recordSeen(kept, zooqle)
+	kept = dedupeItems([]*FeedItem{
+		// same torrent under a different title
+		item(mirror, "Modern Family S09E10 720p [eztv]", "magnet:?xt=urn:btih:C12FE1C06BBA254A9DC9F519B335AA7C1367A88A&tr=udp://x"),
+		// same title with another link
+		item(mirror, "some.movie.2019", "https://zooqle.mirror/movie"),
+		item(mirror, "Another Show S01E01", "magnet:?xt=urn:btih:0000000000000000000000000000000000000000"),
+	}, mirror)
+	if titles := itemTitles(kept); len(titles) != 1 || titles[0] != "Another Show S01E01" {
+		t.Errorf("expected only the new item from the mirror, got %v", titles)
+	}
+
+	// keys older than the window no longer suppress items
+	seen := loadSeen(dir)
+	for key := range seen {
+		seen[key] = time.Now().Add(-2 * time.Hour)
+	}
+	content, _ := json.Marshal(seen)
+	ioutil.WriteFile(seenPath(dir), content, 0644)
+	kept = dedupeItems([]*FeedItem{item(mirror, "some.movie.2019", "https://zooqle.mirror/movie")}, mirror)
+	if len(kept) != 1 {
+		t.Errorf("expected item outside the window to be sent")
+	}
+}
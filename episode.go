@@ -0,0 +1,239 @@
+package feednotifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Episode is what ParseEpisode finds in a release title such as
+// Modern.Family.S09E10.720p.HEVC.x265-MeGusta
+type Episode struct {
+	Show       string
+	Season     int
+	Episode    int
+	Resolution string
+	Codec      string
+}
+
+var (
+	episodeMarker = regexp.MustCompile(`(?i)\bS(\d{1,2})[ .]?E(\d{1,3})\b|\b(\d{1,2})x(\d{2,3})\b`)
+	resolutionTag = regexp.MustCompile(`(?i)\b(2160p|4k|1080p|720p|576p|480p)\b`)
+	codecTag      = regexp.MustCompile(`(?i)\b(x265|h\.?265|hevc|x264|h\.?264|avc|xvid|av1)\b`)
+)
+
+var resolutionRank = map[string]int{"480p": 1, "576p": 2, "720p": 3, "1080p": 4, "2160p": 5}
+var codecRank = map[string]int{"xvid": 1, "h264": 2, "hevc": 3, "av1": 4}
+
+// ParseEpisode parses a release title; it returns nil when the title has no
+// season and episode
+func ParseEpisode(title string) *Episode {
+	m := episodeMarker.FindStringSubmatchIndex(title)
+	if m == nil {
+		return nil
+	}
+	e := &Episode{Show: normalizeShow(title[:m[0]])}
+	if e.Show == "" {
+		return nil
+	}
+	// SxxEyy fills the first two groups, NxNN the last two
+	groups := m[2:6]
+	if groups[0] < 0 {
+		groups = m[6:10]
+	}
+	season, episode := title[groups[0]:groups[1]], title[groups[2]:groups[3]]
+	e.Season, _ = strconv.Atoi(season)
+	e.Episode, _ = strconv.Atoi(episode)
+	e.Resolution, e.Codec = parseQuality(title)
+	return e
+}
+
+// parseQuality returns the normalised resolution and codec tags of a title
+func parseQuality(title string) (resolution, codec string) {
+	resolution = strings.ToLower(resolutionTag.FindString(title))
+	if resolution == "4k" {
+		resolution = "2160p"
+	}
+	switch c := strings.ToLower(strings.Replace(codecTag.FindString(title), ".", "", 1)); c {
+	case "x265", "h265", "hevc":
+		codec = "hevc"
+	case "x264", "h264", "avc":
+		codec = "h264"
+	default:
+		codec = c
+	}
+	return resolution, codec
+}
+
+func normalizeShow(show string) string {
+	// drop a trailing year so "Show 2019 S01E01" and "Show S01E01" match
+	words := strings.Fields(strings.ToLower(nonWord.ReplaceAllString(show, " ")))
+	if n := len(words); n > 1 && len(words[n-1]) == 4 && (strings.HasPrefix(words[n-1], "19") || strings.HasPrefix(words[n-1], "20")) {
+		words = words[:n-1]
+	}
+	return strings.Join(words, " ")
+}
+
+// Key identifies the episode independent of release group and quality
+func (e *Episode) Key() string {
+	return fmt.Sprintf("%s s%02de%02d", e.Show, e.Season, e.Episode)
+}
+
+// Quality ranks releases by resolution first and codec second
+func (e *Episode) Quality() int {
+	return resolutionRank[e.Resolution]*10 + codecRank[e.Codec]
+}
+
+func (e *Episode) String() string {
+	return e.Key()
+}
+
+// episode dedupe modes, set with the episodes=<mode> feed option
+const (
+	episodesDedupe  = "dedupe"
+	episodesUpgrade = "upgrade"
+)
+
+// episodeRetention is how long a sent episode suppresses later releases
+const episodeRetention = 180 * 24 * time.Hour
+
+type seenEpisode struct {
+	Title   string    `json:"title"`
+	FeedURL string    `json:"feedUrl"`
+	Quality int       `json:"quality"`
+	Sent    time.Time `json:"sent"`
+}
+
+// episodeLock serialises updates to the episodes file, which is shared by
+// all feeds under a working directory
+var episodeLock sync.Mutex
+
+func episodesPath(basedir string) string {
+	return filepath.Join(basedir, "episodes.json")
+}
+
+func loadEpisodes(basedir string) map[string]seenEpisode {
+	seen := make(map[string]seenEpisode)
+	content, err := ioutil.ReadFile(episodesPath(basedir))
+	if err == nil {
+		if err = json.Unmarshal(content, &seen); err != nil {
+			log.Warnf("Ignoring corrupt episodes file in %s - %v", basedir, err)
+		}
+	}
+	return seen
+}
+
+func saveEpisodes(basedir string, seen map[string]seenEpisode) {
+	if dryRun {
+		return
+	}
+	for key, episode := range seen {
+		if time.Since(episode.Sent) > episodeRetention {
+			delete(seen, key)
+		}
+	}
+	content, _ := json.MarshalIndent(seen, "", "  ")
+	os.MkdirAll(basedir, os.ModePerm)
+	if err := ioutil.WriteFile(episodesPath(basedir), content, 0644); err != nil {
+		log.Errorf("Unable to save episodes file in %s, %v", basedir, err)
+	}
+}
+
+// dedupeEpisodes drops items for episodes already sent from any feed. In
+// upgrade mode a release of higher quality than the one sent still passes.
+// Items that are not episodes are kept. Episodes are only remembered once
+// they are sent, by recordEpisodes.
+func dedupeEpisodes(items []*FeedItem, value FeedUrl) []*FeedItem {
+	mode := value.opts["episodes"]
+	if mode == "" {
+		return items
+	}
+	if mode != episodesDedupe && mode != episodesUpgrade {
+		log.Warnf("Ignoring unknown episodes mode %q for %s", mode, value.url)
+		return items
+	}
+	episodeLock.Lock()
+	seen := loadEpisodes(value.basedir)
+	episodeLock.Unlock()
+	kept := items[:0]
+	for _, item := range items {
+		if item.Episode == nil {
+			kept = append(kept, item)
+			continue
+		}
+		key, quality := item.Episode.Key(), item.Episode.Quality()
+		if previous, ok := seen[key]; ok {
+			if mode == episodesDedupe || quality <= previous.Quality {
+				log.Infof("Skipping %s from feed %s - already sent %s", item.Title, value.url, previous.Title)
+				continue
+			}
+			log.Infof("Sending %s from feed %s as an upgrade of %s", item.Title, value.url, previous.Title)
+		}
+		// releases later in the same batch are judged against this one
+		seen[key] = seenEpisode{Title: item.Title, FeedURL: value.url, Quality: quality}
+		kept = append(kept, item)
+	}
+	return kept
+}
+
+// recordEpisodes remembers the episodes of sent items for dedupeEpisodes
+func recordEpisodes(items []*FeedItem, value FeedUrl) {
+	if value.opts["episodes"] == "" || len(items) == 0 {
+		return
+	}
+	episodeLock.Lock()
+	defer episodeLock.Unlock()
+	seen := loadEpisodes(value.basedir)
+	for _, item := range items {
+		if item.Episode != nil {
+			seen[item.Episode.Key()] = seenEpisode{Title: item.Title, FeedURL: value.url, Quality: item.Episode.Quality(), Sent: time.Now()}
+		}
+	}
+	saveEpisodes(value.basedir, seen)
+}
+
+// filterQuality drops items whose resolution or codec is not listed in the
+// feed's resolution and codec options, e.g. resolution=720p,1080p codec=hevc
+func filterQuality(items []*FeedItem, value FeedUrl) []*FeedItem {
+	var resolutions, codecs []string
+	for _, r := range splitList(value.opts["resolution"]) {
+		resolution, _ := parseQuality(r)
+		resolutions = append(resolutions, resolution)
+	}
+	for _, c := range splitList(value.opts["codec"]) {
+		_, codec := parseQuality(c)
+		codecs = append(codecs, codec)
+	}
+	if len(resolutions) == 0 && len(codecs) == 0 {
+		return items
+	}
+	kept := items[:0]
+	for _, item := range items {
+		resolution, codec := parseQuality(item.Title)
+		if (len(resolutions) > 0 && !contains(resolutions, resolution)) ||
+			(len(codecs) > 0 && !contains(codecs, codec)) {
+			log.Infof("Excluding item %s from feed %s - quality %s %s", item.Title, value.url, resolution, codec)
+			continue
+		}
+		kept = append(kept, item)
+	}
+	return kept
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if value != "" && v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+package feednotifier
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func TestParseEpisode(t *testing.T) {
+	tests := []struct {
+		title string
+		want  *Episode
+	}{
+		{"Modern.Family.S09E10.720p.HEVC.x265-MeGusta", &Episode{"modern family", 9, 10, "720p", "hevc"}},
+		{"Modern Family s09e10 1080p WEB x264-TBS", &Episode{"modern family", 9, 10, "1080p", "h264"}},
+		{"The.Expanse.2015.S04E01.2160p.H.265", &Episode{"the expanse", 4, 1, "2160p", "hevc"}},
+		{"Doctor Who 12x03 XviD", &Episode{"doctor who", 12, 3, "", "xvid"}},
+		{"Some.Movie.2019.1080p.BluRay", nil},
+		{"S01E01.720p", nil},
+	}
+	for _, test := range tests {
+		got := ParseEpisode(test.title)
+		if (got == nil) != (test.want == nil) || (got != nil && *got != *test.want) {
+			t.Errorf("%s: expected %+v, got %+v", test.title, test.want, got)
+		}
+	}
+	if key := ParseEpisode("Modern.Family.S09E10.720p").Key(); key != "modern family s09e10" {
+		t.Errorf("unexpected key %s", key)
+	}
+}
+
+func episodeItems(value FeedUrl, titles ...string) []*FeedItem {
+	var items []*FeedItem
+	for _, title := range titles {
+		items = append(items, newFeedItem(nil, &gofeed.Item{Title: title}, value))
+	}
+	return items
+}
+
+func itemTitles(items []*FeedItem) []string {
+	var titles []string
+	for _, item := range items {
+		titles = append(titles, item.Title)
+	}
+	return titles
+}
+
+func TestDedupeEpisodes(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "feednotifier")
+	defer os.RemoveAll(dir)
+	zooqle := FeedUrl{url: "https://zooqle.com/rss", basedir: dir, opts: map[string]string{"episodes": "dedupe"}}
+	eztv := FeedUrl{url: "https://eztv.io/rss", basedir: dir, opts: map[string]string{"episodes": "upgrade"}}
+
+	kept := dedupeEpisodes(episodeItems(zooqle,
+		"Modern.Family.S09E10.720p.x264-AVS",
+		"Modern.Family.S09E10.720p.HEVC.x265-MeGusta",
+		"Some.Movie.2019.1080p"), zooqle)
+	if titles := itemTitles(kept); len(titles) != 2 || titles[0] != "Modern.Family.S09E10.720p.x264-AVS" {
+		t.Errorf("expected the first release and the movie, got %v", titles)
+	}
+	// episodes are only remembered once sent
+	if again := dedupeEpisodes(episodeItems(zooqle, "Modern.Family.S09E10.720p.x264-AVS"), zooqle); len(again) != 1 {
+		t.Errorf("expected an episode that wasn't sent to pass again")
+	}
+	recordEpisodes(kept, zooqle)
+	// another feed only gets releases of higher quality through
+	kept = dedupeEpisodes(episodeItems(eztv,
+		"Modern Family S09E10 480p",
+		"Modern Family S09E10 1080p HEVC",
+		"Modern Family S09E11 480p"), eztv)
+	if titles := itemTitles(kept); len(titles) != 2 || titles[0] != "Modern Family S09E10 1080p HEVC" {
+		t.Errorf("expected the upgrade and the new episode, got %v", titles)
+	}
+	recordEpisodes(kept, eztv)
+	// the upgrade is now the release to beat
+	kept = dedupeEpisodes(episodeItems(eztv, "Modern.Family.S09E10.1080p.x264"), eztv)
+	if len(kept) != 0 {
+		t.Errorf("expected lower quality release to be skipped, got %v", itemTitles(kept))
+	}
+	// feeds without the option are not deduped
+	plain := FeedUrl{url: "https://example.com/rss", basedir: dir}
+	if kept = dedupeEpisodes(episodeItems(plain, "Modern.Family.S09E10.720p"), plain); len(kept) != 1 {
+		t.Errorf("expected feeds without episodes option to keep items")
+	}
+}
+
+func TestFilterQuality(t *testing.T) {
+	value := FeedUrl{url: "https://zooqle.com/rss", opts: map[string]string{"resolution": "720p, 4k", "codec": "x265"}}
+	kept := filterQuality(episodeItems(value,
+		"Modern.Family.S09E10.720p.HEVC",
+		"Modern.Family.S09E10.1080p.HEVC",
+		"Modern.Family.S09E10.720p.x264",
+		"The.Expanse.S04E01.2160p.H.265",
+		"Modern.Family.S09E10.HEVC"), value)
+	if titles := itemTitles(kept); len(titles) != 2 || titles[1] != "The.Expanse.S04E01.2160p.H.265" {
+		t.Errorf("unexpected items after quality filter %v", titles)
+	}
+}
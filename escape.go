@@ -0,0 +1,135 @@
+package feednotifier
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// outputFormat is the markup a notifier sends messages in
+type outputFormat string
+
+const (
+	formatText       outputFormat = ""
+	formatMarkdown   outputFormat = "markdown"
+	formatMarkdownV2 outputFormat = "markdownv2"
+	formatHTML       outputFormat = "html"
+)
+
+func parseOutputFormat(s string) (outputFormat, error) {
+	switch f := outputFormat(strings.ToLower(s)); f {
+	case formatText, formatMarkdown, formatMarkdownV2, formatHTML:
+		return f, nil
+	}
+	return formatText, fmt.Errorf("unknown format %s - expected markdown, markdownv2 or html", s)
+}
+
+// escapers are appended to every action of a template rendered in their
+// format, the way html/template escapes pipelines
+var escapers = map[outputFormat]string{
+	formatMarkdown:   "escapeMarkdown",
+	formatMarkdownV2: "escapeMarkdownV2",
+	formatHTML:       "escapeHTML",
+}
+
+// safeFuncs mark a pipeline's output as already escaped
+var safeFuncs = map[string]bool{
+	"raw":              true,
+	"escapeMarkdown":   true,
+	"escapeMarkdownV2": true,
+	"escapeHTML":       true,
+}
+
+var markdownV2Escaper = strings.NewReplacer(
+	"\\", "\\\\", "_", "\\_", "*", "\\*", "[", "\\[", "]", "\\]", "(", "\\(", ")", "\\)",
+	"~", "\\~", "`", "\\`", ">", "\\>", "#", "\\#", "+", "\\+", "-", "\\-", "=", "\\=",
+	"|", "\\|", "{", "\\{", "}", "\\}", ".", "\\.", "!", "\\!")
+
+// escapeMarkdownV2 escapes all characters reserved by telegram's MarkdownV2
+func escapeMarkdownV2(v interface{}) string {
+	return markdownV2Escaper.Replace(fmt.Sprint(v))
+}
+
+func escapeHTML(v interface{}) string {
+	return html.EscapeString(fmt.Sprint(v))
+}
+
+// raw marks a value as safe so that it is not escaped
+func raw(v interface{}) interface{} {
+	return v
+}
+
+func escapeMessage(format outputFormat, msg string) string {
+	switch format {
+	case formatMarkdown:
+		return escapeMarkdown(msg)
+	case formatMarkdownV2:
+		return escapeMarkdownV2(msg)
+	case formatHTML:
+		return escapeHTML(msg)
+	}
+	return msg
+}
+
+// escapeTemplates rewrites every template in t so that interpolated values
+// are escaped for format. The parse trees are copied; t is modified in place
+// so it should be a clone.
+func escapeTemplates(t *template.Template, format outputFormat) error {
+	escaper, ok := escapers[format]
+	if !ok {
+		return nil
+	}
+	for _, tmpl := range t.Templates() {
+		if tmpl.Tree == nil {
+			continue
+		}
+		tree := tmpl.Tree.Copy()
+		escapeNode(tree.Root, escaper)
+		if _, err := t.AddParseTree(tmpl.Name(), tree); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func escapeNode(node parse.Node, escaper string) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for i, child := range n.Nodes {
+			// legacy markdown has no escapes in link targets, where they
+			// would end up in the url
+			if escaper == "escapeMarkdown" && i > 0 {
+				if text, ok := n.Nodes[i-1].(*parse.TextNode); ok && strings.HasSuffix(string(text.Text), "](") {
+					continue
+				}
+			}
+			escapeNode(child, escaper)
+		}
+	case *parse.ActionNode:
+		pipe := n.Pipe
+		if len(pipe.Decl) > 0 || len(pipe.Cmds) == 0 {
+			return
+		}
+		last := pipe.Cmds[len(pipe.Cmds)-1]
+		if ident, ok := last.Args[0].(*parse.IdentifierNode); ok && safeFuncs[ident.Ident] {
+			return
+		}
+		cmd := &parse.CommandNode{NodeType: parse.NodeCommand, Pos: last.Pos}
+		cmd.Args = []parse.Node{parse.NewIdentifier(escaper).SetPos(last.Pos)}
+		pipe.Cmds = append(pipe.Cmds, cmd)
+	case *parse.IfNode:
+		escapeNode(n.List, escaper)
+		escapeNode(n.ElseList, escaper)
+	case *parse.RangeNode:
+		escapeNode(n.List, escaper)
+		escapeNode(n.ElseList, escaper)
+	case *parse.WithNode:
+		escapeNode(n.List, escaper)
+		escapeNode(n.ElseList, escaper)
+	}
+}
@@ -0,0 +1,92 @@
+package feednotifier
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// exec feeds run a program on every check and read its output:
+//
+//	exec:/usr/local/bin/releases args="--all --json" format=jsonlines
+//
+//	args=ARGS         arguments, split on whitespace
+//	dir=FOLDER        working directory
+//	env=K=V,K=V       variables added to the environment
+//	timeout=DURATION  the program, and programs it started, are killed after
+//	                  this long; default 1m
+//	format=FORMAT     feed for rss, atom or json feed output (default), json
+//	                  for a json document or jsonlines for a json object per
+//	                  line; json fields are picked as for type=json
+
+// defaultExecTimeout is how long a program may run without timeout=
+const defaultExecTimeout = time.Minute
+
+func execSource(value FeedUrl) ([]byte, error) {
+	command := strings.TrimPrefix(value.url, "exec:")
+	command = strings.TrimPrefix(command, "//")
+	if command == "" {
+		return nil, fmt.Errorf("exec feed %s has no command", value.url)
+	}
+	timeout := defaultExecTimeout
+	if v, ok := value.opts["timeout"]; ok {
+		d, err := parseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid timeout=%s for %s", v, value.url)
+		}
+		timeout = d
+	}
+	cmd := exec.Command(command, strings.Fields(value.opts["args"])...)
+	cmd.Dir = value.opts["dir"]
+	cmd.Env = os.Environ()
+	for _, kv := range splitList(value.opts["env"]) {
+		if !strings.Contains(kv, "=") {
+			return nil, fmt.Errorf("invalid env %s for %s - expected KEY=VALUE", kv, value.url)
+		}
+		cmd.Env = append(cmd.Env, kv)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	// programs started in the background would keep the output open, and
+	// Wait from returning, if only the command itself was killed
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("%s failed, %v", command, err)
+	}
+	timer := time.AfterFunc(timeout, func() { killProcessGroup(cmd) })
+	if err := cmd.Wait(); err != nil {
+		if !timer.Stop() {
+			return nil, fmt.Errorf("%s timed out after %v", command, timeout)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s failed, %v: %s", command, err, msg)
+		}
+		return nil, fmt.Errorf("%s failed, %v", command, err)
+	}
+	timer.Stop()
+	var feed *gofeed.Feed
+	var err error
+	switch format := value.opts["format"]; format {
+	case "", "feed":
+		// parsed here so a broken run doesn't replace the base file
+		if _, err := ParseFeed(bytes.NewReader(stdout.Bytes())); err != nil {
+			return nil, fmt.Errorf("could not parse output of %s, %v", command, err)
+		}
+		return stdout.Bytes(), nil
+	case "json":
+		feed, err = jsonItems(&stdout, value)
+	case "jsonlines":
+		feed, err = jsonLines(&stdout, value)
+	default:
+		return nil, fmt.Errorf("unknown format=%s for %s - expected feed, json or jsonlines", format, value.url)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return marshalJSONFeed(feed)
+}
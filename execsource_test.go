@@ -0,0 +1,81 @@
+package feednotifier
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExecSource(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "feednotifier")
+	defer os.RemoveAll(dir)
+	script := filepath.Join(dir, "releases.sh")
+	ioutil.WriteFile(script, []byte(`printf '{"id": 1, "title": "%s", "url": "https://example.org/%s"}\n\n' "$RELEASE" "$(basename "$PWD")"`), 0644)
+
+	content, err := execSource(FeedUrl{url: "exec:/bin/sh", opts: map[string]string{
+		"args": script, "env": "RELEASE=v1.0", "dir": dir, "format": "jsonlines",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	feed, err := ParseFeed(bytes.NewReader(content))
+	if err != nil || len(feed.Items) != 1 {
+		t.Fatalf("expected a json feed with one item, got %v", err)
+	}
+	if item := feed.Items[0]; item.Title != "v1.0" || item.GUID != "1" || item.Link != "https://example.org/"+filepath.Base(dir) {
+		t.Errorf("expected env and working dir to be set, got %+v", item)
+	}
+
+	content, err = execSource(FeedUrl{url: "exec:cat", opts: map[string]string{"args": "test/zooqle.first.xml"}})
+	first, _ := ioutil.ReadFile("test/zooqle.first.xml")
+	if err != nil || !bytes.Equal(content, first) {
+		t.Errorf("expected feed output to be kept as is, got %v", err)
+	}
+
+	tests := []struct {
+		value FeedUrl
+		want  string
+	}{
+		{FeedUrl{url: "exec:sleep", opts: map[string]string{"args": "5", "timeout": "100ms"}}, "timed out"},
+		{FeedUrl{url: "exec:/bin/sh", opts: map[string]string{"args": "-c", "format": "json"}}, "failed"},
+		{FeedUrl{url: "exec:echo", opts: map[string]string{"args": "not a feed"}}, "could not parse"},
+		{FeedUrl{url: "exec:echo", opts: map[string]string{"format": "yaml"}}, "unknown format"},
+	}
+	for _, test := range tests {
+		if _, err := execSource(test.value); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s %v: expected %q error, got %v", test.value.url, test.value.opts, test.want, err)
+		}
+	}
+
+	// the timeout also stops programs the command started
+	background := filepath.Join(dir, "background.sh")
+	ioutil.WriteFile(background, []byte("sleep 5 &\nsleep 5\n"), 0644)
+	start := time.Now()
+	if _, err := execSource(FeedUrl{url: "exec:/bin/sh", opts: map[string]string{"args": background, "timeout": "1s"}}); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("expected background programs to be killed at the timeout, took %v", elapsed)
+	}
+}
+
+func TestProcessLineExec(t *testing.T) {
+	initTemplates()
+	dir, _ := ioutil.TempDir("", "feednotifier")
+	defer os.RemoveAll(dir)
+	out := &bytes.Buffer{}
+	notifiers := []Notifier{NewDryRunNotifier(newPushover("abc", "def"), out)}
+	line := "exec:cat"
+	value := FeedUrl{url: line, savePath: SavePath(dir, line), basedir: dir, opts: map[string]string{"args": "test/zooqle.first.xml"}}
+	processLine(line, value, notifiers)
+	value.opts["args"] = "test/zooqle.second.xml"
+	out.Reset()
+	processLine(line, value, notifiers)
+	if !strings.Contains(out.String(), "template: __message") {
+		t.Errorf("expected new items from the command output, got %s", out.String())
+	}
+}
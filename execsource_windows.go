@@ -0,0 +1,11 @@
+package feednotifier
+
+import "os/exec"
+
+// setProcessGroup does nothing on windows, where only the program itself is
+// killed
+func setProcessGroup(cmd *exec.Cmd) {}
+
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
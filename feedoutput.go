@@ -0,0 +1,589 @@
+package feednotifier
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultFeedHistory is how many items each output feed keeps
+const defaultFeedHistory = 50
+
+// feed output groupings
+const (
+	groupByFile = "file"
+	groupByTag  = "tag"
+)
+
+// outputItem is an item republished by a feed output
+type outputItem struct {
+	ID          string    `json:"id"`
+	Title       string    `json:"title"`
+	Link        string    `json:"link"`
+	Description string    `json:"description,omitempty"`
+	Content     string    `json:"content,omitempty"`
+	Published   time.Time `json:"published"`
+	Updated     time.Time `json:"updated"`
+	Source      string    `json:"source,omitempty"`
+	// SourceURL is the feed's label, as the url may hold credentials
+	SourceURL string   `json:"sourceUrl"`
+	Tags      []string `json:"tags,omitempty"`
+	Torrent   string   `json:"torrent,omitempty"`
+}
+
+// feedOutput is a notifier that republishes items as Atom, RSS 2.0 and JSON
+// Feed documents, one set per watch file or per tag. The documents are
+// written to dir, if set, and served under /feeds/ like the dashboard.
+type feedOutput struct {
+	dir     string
+	groupBy string
+	history int
+	lock    sync.Mutex
+	// items are kept per group, newest first
+	items map[string][]outputItem
+	// fileGroups are the groups of the watch files by absolute path
+	fileGroups map[string]string
+}
+
+// feedOutputs holds every feed output so the server can find them
+var feedOutputs struct {
+	sync.Mutex
+	list []*feedOutput
+}
+
+func newFeedOutput(dir, groupBy string, history int) *feedOutput {
+	o := &feedOutput{dir: dir, groupBy: groupBy, history: history, items: make(map[string][]outputItem), fileGroups: make(map[string]string)}
+	if dir != "" {
+		content, err := ioutil.ReadFile(o.historyPath())
+		if err == nil {
+			if err = json.Unmarshal(content, &o.items); err != nil {
+				log.Warnf("Ignoring corrupt feed output history in %s - %v", dir, err)
+			}
+		}
+		content, err = ioutil.ReadFile(o.groupsPath())
+		if err == nil {
+			if err = json.Unmarshal(content, &o.fileGroups); err != nil {
+				log.Warnf("Ignoring corrupt feed output groups in %s - %v", dir, err)
+			}
+		}
+	}
+	feedOutputs.Lock()
+	feedOutputs.list = append(feedOutputs.list, o)
+	feedOutputs.Unlock()
+	return o
+}
+
+func (o *feedOutput) String() string {
+	return fmt.Sprintf("[FEED: %s by %s]", o.dir, o.groupBy)
+}
+
+// outputStateDir holds the history and groups of an output under its folder,
+// apart from the documents so no group name can replace them
+const outputStateDir = ".feednotifier"
+
+func (o *feedOutput) historyPath() string {
+	return filepath.Join(o.dir, outputStateDir, "history.json")
+}
+
+func (o *feedOutput) groupsPath() string {
+	return filepath.Join(o.dir, outputStateDir, "groups.json")
+}
+
+// fileGroup returns the group of a watch file: its name without extension,
+// followed by a hash of its path when another watch file has that name. The
+// groups are saved so a feed keeps its name across restarts.
+func (o *feedOutput) fileGroup(watchFile string) string {
+	path, err := filepath.Abs(watchFile)
+	if err != nil {
+		path = watchFile
+	}
+	if group, ok := o.fileGroups[path]; ok {
+		return group
+	}
+	base := filepath.Base(path)
+	group := strings.TrimSuffix(base, filepath.Ext(base))
+	for _, used := range o.fileGroups {
+		if used == group {
+			group = fmt.Sprintf("%s-%x", group, md5.Sum([]byte(path)))[:len(group)+7]
+			break
+		}
+	}
+	o.fileGroups[path] = group
+	return group
+}
+
+// groups returns the feeds an item is published in
+func (o *feedOutput) groups(item *FeedItem) []string {
+	if o.groupBy == groupByTag {
+		if len(item.Tags) == 0 {
+			return []string{"untagged"}
+		}
+		groups := make([]string, len(item.Tags))
+		for i, tag := range item.Tags {
+			groups[i] = strings.NewReplacer("/", "-", "\\", "-").Replace(tag)
+		}
+		return groups
+	}
+	if item.WatchFile == "" {
+		return []string{"feednotifier"}
+	}
+	return []string{o.fileGroup(item.WatchFile)}
+}
+
+func newOutputItem(item *FeedItem) outputItem {
+	id := item.GUID
+	if id == "" {
+		id = item.Link
+	}
+	if id == "" {
+		id = contentHash(item.Item, []string{"title", "description"})
+	}
+	now := time.Now()
+	published := itemTime(item.Item)
+	if published.IsZero() {
+		published = now
+	}
+	source := item.Label
+	if source == "" && item.Feed != nil {
+		source = item.Feed.Title
+	}
+	return outputItem{
+		ID:          id,
+		Title:       item.Title,
+		Link:        item.Link,
+		Description: item.Description,
+		Content:     item.Content,
+		Published:   published,
+		Updated:     now,
+		Source:      source,
+		SourceURL:   feedLabel(item.FeedURL),
+		Tags:        item.Tags,
+		Torrent:     torrentURI(item),
+	}
+}
+
+// NotifyItem adds the item to its feeds; an update replaces the item sent
+// before
+func (o *feedOutput) NotifyItem(item *FeedItem) error {
+	entry := newOutputItem(item)
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	groups := o.groups(item)
+	for _, group := range groups {
+		items := []outputItem{entry}
+		for _, existing := range o.items[group] {
+			if existing.ID != entry.ID || existing.SourceURL != entry.SourceURL {
+				items = append(items, existing)
+			}
+		}
+		if len(items) > o.history {
+			items = items[:o.history]
+		}
+		o.items[group] = items
+	}
+	return o.write(groups)
+}
+
+// Notify ignores messages; feed readers only get items
+func (o *feedOutput) Notify(msg string) error {
+	return nil
+}
+
+func (o *feedOutput) Validate() error {
+	if o.dir == "" {
+		if !listening || (webUser == "" && !webOpen) {
+			return fmt.Errorf("feed notifier without a folder keeps items in memory only - set a folder, or --listen with --web-user or --web-open to serve them")
+		}
+		return nil
+	}
+	if err := os.MkdirAll(o.dir, os.ModePerm); err != nil {
+		return err
+	}
+	probe := filepath.Join(o.dir, ".validate")
+	if err := ioutil.WriteFile(probe, nil, 0644); err != nil {
+		return err
+	}
+	return os.Remove(probe)
+}
+
+// feedFormats maps file extensions to the renderer and content type of each
+// format
+var feedFormats = map[string]struct {
+	contentType string
+	render      func(name string, items []outputItem) ([]byte, error)
+}{
+	".atom": {"application/atom+xml; charset=utf-8", renderAtom},
+	".rss":  {"application/rss+xml; charset=utf-8", renderRSS},
+	".json": {"application/feed+json; charset=utf-8", renderJSONFeed},
+}
+
+// write saves the documents of the changed groups and the history; the
+// caller holds the lock
+func (o *feedOutput) write(groups []string) error {
+	if o.dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Join(o.dir, outputStateDir), os.ModePerm); err != nil {
+		return err
+	}
+	for _, group := range groups {
+		for ext, format := range feedFormats {
+			content, err := format.render(group, o.items[group])
+			if err != nil {
+				return err
+			}
+			if err := writeFileAtomic(filepath.Join(o.dir, group+ext), content); err != nil {
+				return err
+			}
+		}
+	}
+	if o.groupBy == groupByFile {
+		content, _ := json.MarshalIndent(o.fileGroups, "", "  ")
+		if err := writeFileAtomic(o.groupsPath(), content); err != nil {
+			return err
+		}
+	}
+	content, _ := json.MarshalIndent(o.items, "", "  ")
+	return writeFileAtomic(o.historyPath(), content)
+}
+
+func writeFileAtomic(filename string, content []byte) error {
+	tmp := filename + ".tmp"
+	if err := ioutil.WriteFile(tmp, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+// renderOutput returns a document of the named group; ok is false when no
+// output has the group
+func renderOutput(group, ext string) (content []byte, contentType string, ok bool, err error) {
+	format, known := feedFormats[ext]
+	if !known {
+		return nil, "", false, nil
+	}
+	feedOutputs.Lock()
+	outputs := append([]*feedOutput{}, feedOutputs.list...)
+	feedOutputs.Unlock()
+	for _, o := range outputs {
+		o.lock.Lock()
+		items, found := o.items[group]
+		if found {
+			content, err = format.render(group, items)
+		}
+		o.lock.Unlock()
+		if found {
+			return content, format.contentType, true, err
+		}
+	}
+	return nil, "", false, nil
+}
+
+// outputGroups returns the names of all output feeds
+func outputGroups() []string {
+	feedOutputs.Lock()
+	defer feedOutputs.Unlock()
+	seen := make(map[string]bool)
+	var names []string
+	for _, o := range feedOutputs.list {
+		o.lock.Lock()
+		for group := range o.items {
+			if !seen[group] {
+				seen[group] = true
+				names = append(names, group)
+			}
+		}
+		o.lock.Unlock()
+	}
+	sort.Strings(names)
+	return names
+}
+
+// feedsOutputHandler serves /feeds/<group>.atom, .rss and .json, and lists
+// the groups on /feeds/
+func feedsOutputHandler(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/feeds/")
+	if name == "" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, group := range outputGroups() {
+			fmt.Fprintf(w, "%s.atom\n%s.rss\n%s.json\n", group, group, group)
+		}
+		return
+	}
+	ext := filepath.Ext(name)
+	content, contentType, ok, err := renderOutput(strings.TrimSuffix(name, ext), ext)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Errorf("Error rendering feed %s, %v", name, err)
+		http.Error(w, "feed unavailable", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(content)
+}
+
+func outputTitle(group string) string {
+	return "feednotifier: " + group
+}
+
+// torrentType is the enclosure type of magnet and .torrent links
+const torrentType = "application/x-bittorrent"
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr,omitempty"`
+	Body string `xml:",chardata"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	ID         string         `xml:"id"`
+	Links      []atomLink     `xml:"link"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Author     string         `xml:"author>name"`
+	Categories []atomCategory `xml:"category"`
+	Summary    *atomText      `xml:"summary,omitempty"`
+	Content    *atomText      `xml:"content,omitempty"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Author  string      `xml:"author>name"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+func updated(items []outputItem) time.Time {
+	var latest time.Time
+	for _, item := range items {
+		if item.Updated.After(latest) {
+			latest = item.Updated
+		}
+	}
+	if latest.IsZero() {
+		latest = time.Now()
+	}
+	return latest
+}
+
+func htmlBody(text string) *atomText {
+	if text == "" {
+		return nil
+	}
+	return &atomText{Type: "html", Body: text}
+}
+
+func renderAtom(group string, items []outputItem) ([]byte, error) {
+	feed := atomFeed{
+		Title:   outputTitle(group),
+		ID:      "urn:feednotifier:" + group,
+		Updated: updated(items).Format(time.RFC3339),
+		Author:  "feednotifier",
+	}
+	for _, item := range items {
+		entry := atomEntry{
+			Title:     item.Title,
+			ID:        item.ID,
+			Published: item.Published.Format(time.RFC3339),
+			Updated:   item.Updated.Format(time.RFC3339),
+			Author:    item.Source,
+			Summary:   htmlBody(item.Description),
+			Content:   htmlBody(item.Content),
+		}
+		if item.Link != "" {
+			entry.Links = append(entry.Links, atomLink{Href: item.Link, Rel: "alternate"})
+		}
+		if item.Torrent != "" && item.Torrent != item.Link {
+			entry.Links = append(entry.Links, atomLink{Href: item.Torrent, Rel: "enclosure", Type: torrentType})
+		}
+		for _, tag := range item.Tags {
+			entry.Categories = append(entry.Categories, atomCategory{Term: tag})
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	return marshalXML(feed)
+}
+
+type rssGUID struct {
+	IsPermaLink string `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length string `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+type rssSource struct {
+	URL  string `xml:"url,attr"`
+	Name string `xml:",chardata"`
+}
+
+type rssItem struct {
+	Title       string        `xml:"title"`
+	Link        string        `xml:"link,omitempty"`
+	Description string        `xml:"description,omitempty"`
+	GUID        rssGUID       `xml:"guid"`
+	PubDate     string        `xml:"pubDate"`
+	Categories  []string      `xml:"category"`
+	Enclosure   *rssEnclosure `xml:"enclosure,omitempty"`
+	Source      *rssSource    `xml:"source,omitempty"`
+}
+
+type rssFeed struct {
+	XMLName       xml.Name  `xml:"rss"`
+	Version       string    `xml:"version,attr"`
+	Title         string    `xml:"channel>title"`
+	Link          string    `xml:"channel>link"`
+	Description   string    `xml:"channel>description"`
+	LastBuildDate string    `xml:"channel>lastBuildDate"`
+	Items         []rssItem `xml:"channel>item"`
+}
+
+func renderRSS(group string, items []outputItem) ([]byte, error) {
+	feed := rssFeed{
+		Version:       "2.0",
+		Title:         outputTitle(group),
+		Description:   "Items sent by feednotifier for " + group,
+		LastBuildDate: updated(items).Format(time.RFC1123Z),
+	}
+	if len(items) > 0 {
+		feed.Link = items[0].SourceURL
+	}
+	for _, item := range items {
+		description := item.Content
+		if description == "" {
+			description = item.Description
+		}
+		entry := rssItem{
+			Title:       item.Title,
+			Link:        item.Link,
+			Description: description,
+			GUID:        rssGUID{IsPermaLink: "false", Value: item.ID},
+			PubDate:     item.Published.Format(time.RFC1123Z),
+			Categories:  item.Tags,
+		}
+		if item.Torrent != "" {
+			entry.Enclosure = &rssEnclosure{URL: item.Torrent, Length: "0", Type: torrentType}
+		}
+		if item.SourceURL != "" {
+			entry.Source = &rssSource{URL: item.SourceURL, Name: item.Source}
+		}
+		feed.Items = append(feed.Items, entry)
+	}
+	return marshalXML(feed)
+}
+
+func marshalXML(v interface{}) ([]byte, error) {
+	content, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), content...), nil
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+	URL  string `json:"url,omitempty"`
+}
+
+type jsonFeedAttachment struct {
+	URL      string `json:"url"`
+	MimeType string `json:"mime_type"`
+}
+
+type jsonFeedItem struct {
+	ID            string               `json:"id"`
+	URL           string               `json:"url,omitempty"`
+	Title         string               `json:"title"`
+	ContentHTML   string               `json:"content_html"`
+	Summary       string               `json:"summary,omitempty"`
+	DatePublished string               `json:"date_published"`
+	DateModified  string               `json:"date_modified"`
+	Authors       []jsonFeedAuthor     `json:"authors,omitempty"`
+	Tags          []string             `json:"tags,omitempty"`
+	Attachments   []jsonFeedAttachment `json:"attachments,omitempty"`
+}
+
+type jsonFeed struct {
+	Version string         `json:"version"`
+	Title   string         `json:"title"`
+	Items   []jsonFeedItem `json:"items"`
+}
+
+func renderJSONFeed(group string, items []outputItem) ([]byte, error) {
+	feed := jsonFeed{Version: "https://jsonfeed.org/version/1.1", Title: outputTitle(group), Items: []jsonFeedItem{}}
+	for _, item := range items {
+		content := item.Content
+		if content == "" {
+			content = item.Description
+		}
+		entry := jsonFeedItem{
+			ID:            item.ID,
+			URL:           item.Link,
+			Title:         item.Title,
+			ContentHTML:   content,
+			DatePublished: item.Published.Format(time.RFC3339),
+			DateModified:  item.Updated.Format(time.RFC3339),
+			Tags:          item.Tags,
+		}
+		if item.Content != "" {
+			entry.Summary = item.Description
+		}
+		if item.Source != "" || item.SourceURL != "" {
+			entry.Authors = []jsonFeedAuthor{{Name: item.Source, URL: item.SourceURL}}
+		}
+		if item.Torrent != "" {
+			entry.Attachments = []jsonFeedAttachment{{URL: item.Torrent, MimeType: torrentType}}
+		}
+		feed.Items = append(feed.Items, entry)
+	}
+	return json.MarshalIndent(feed, "", "  ")
+}
+
+// parseFeedOutput parses the value of a feed:[DIR][#file|#tag][#HISTORY] spec
+func parseFeedOutput(value string) (*feedOutput, error) {
+	parts := strings.Split(value, "#")
+	groupBy, history := groupByFile, defaultFeedHistory
+	for _, option := range parts[1:] {
+		switch option {
+		case groupByFile, groupByTag:
+			groupBy = option
+		default:
+			n, err := strconv.Atoi(option)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("Error parsing feed notifier spec - options are file or tag and the number of items to keep")
+			}
+			history = n
+		}
+	}
+	return newFeedOutput(parts[0], groupBy, history), nil
+}
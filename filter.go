@@ -0,0 +1,78 @@
+package feednotifier
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+	log "github.com/sirupsen/logrus"
+)
+
+var nonWord = regexp.MustCompile(`[^\pL\pN]+`)
+
+// titlePattern builds a case insensitive pattern matching titles that start
+// like title, e.g. "Modern.Family.S09E10.720p" gives (?i)\bmodern\W+family\W+s09e10.
+// It returns "" for titles without words, which no pattern should stand for.
+func titlePattern(title string) string {
+	words := strings.Fields(strings.ToLower(nonWord.ReplaceAllString(title, " ")))
+	if len(words) == 0 {
+		return ""
+	}
+	if len(words) > 3 {
+		words = words[:3]
+	}
+	for i, w := range words {
+		words[i] = regexp.QuoteMeta(w)
+	}
+	return `(?i)\b` + strings.Join(words, `\W+`)
+}
+
+func compilePatterns(feedURL string, patterns []string) []*regexp.Regexp {
+	var compiled []*regexp.Regexp
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			log.Warnf("Ignoring invalid pattern %q for %s - %v", p, feedURL, err)
+			continue
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled
+}
+
+func matchesAny(title string, patterns []*regexp.Regexp) bool {
+	for _, re := range patterns {
+		if re.MatchString(title) {
+			return true
+		}
+	}
+	return false
+}
+
+// excludePatterns compiles the feed's exclude option and the exclude rules
+// recorded in its state
+func excludePatterns(value FeedUrl, state FeedState) []*regexp.Regexp {
+	patterns := state.Exclude
+	if exclude := value.opts["exclude"]; exclude != "" {
+		patterns = append([]string{exclude}, patterns...)
+	}
+	return compilePatterns(value.url, patterns)
+}
+
+// excludeItems drops items whose titles match the feed's exclude option or
+// the exclude rules recorded in its state
+func excludeItems(items []*gofeed.Item, value FeedUrl, state FeedState) []*gofeed.Item {
+	excludes := excludePatterns(value, state)
+	if len(excludes) == 0 {
+		return items
+	}
+	kept := items[:0]
+	for _, item := range items {
+		if matchesAny(item.Title, excludes) {
+			log.Infof("Excluding item %s from feed %s", item.Title, value.url)
+			continue
+		}
+		kept = append(kept, item)
+	}
+	return kept
+}
@@ -0,0 +1,46 @@
+package feednotifier
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func TestExcludeItems(t *testing.T) {
+	items := []*gofeed.Item{
+		{Title: "Modern Family S09E10 720p HEVC x265-MeGusta"},
+		{Title: "Modern.Family.S09E10.1080p.WEB.x264"},
+		{Title: "Modern Family S09E11 720p HEVC x265-MeGusta"},
+		{Title: "Blue Planet II S01E01 CAM"},
+	}
+	value := FeedUrl{url: "https://zooqle.com/rss", opts: map[string]string{"exclude": `(?i)\bcam\b`}}
+	state := FeedState{Exclude: []string{titlePattern("Modern.Family.S09E10.720p")}}
+
+	kept := excludeItems(items, value, state)
+	if len(kept) != 1 || !strings.Contains(kept[0].Title, "S09E11") {
+		for _, item := range kept {
+			t.Log(item.Title)
+		}
+		t.Errorf("expected only S09E11 to be kept")
+	}
+}
+
+func TestTitlePattern(t *testing.T) {
+	if p := titlePattern("Modern.Family.S09E10.720p"); p != `(?i)\bmodern\W+family\W+s09e10` {
+		t.Errorf("unexpected pattern %s", p)
+	}
+	for _, title := range []string{"", "!!!"} {
+		if p := titlePattern(title); p != "" {
+			t.Errorf("expected no pattern for %q, got %s", title, p)
+		}
+	}
+}
+
+func TestMagnetURIShortening(t *testing.T) {
+	long := "magnet:?xt=urn:btih:f5b213fb4978faed6b453a722aa18d8f9a766647&dn=Blue.Planet" + strings.Repeat("&tr=udp%3A%2F%2Ftracker.example.org%3A6969", 10)
+	item := &FeedItem{Item: &gofeed.Item{Link: long}}
+	if m := magnetURI(item); m != "magnet:?xt=urn:btih:f5b213fb4978faed6b453a722aa18d8f9a766647&dn=Blue.Planet" {
+		t.Errorf("unexpected shortened magnet %s", m)
+	}
+}
@@ -0,0 +1,111 @@
+package feednotifier
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// healthState tracks what /healthz and /readyz report: whether the
+// scheduler is still running jobs and whether startup completed
+type healthState struct {
+	sync.Mutex
+	started   time.Time
+	interval  time.Duration
+	lastTick  time.Time
+	files     map[string]bool
+	notifiers int
+	notified  bool
+}
+
+var health = &healthState{started: time.Now(), files: make(map[string]bool)}
+
+// tickGrace is how late a scheduled run may be before the process is
+// reported unhealthy; a run over many slow feeds takes a while
+const tickGrace = 5 * time.Minute
+
+// MarkNotifiersReady records that the notifiers were constructed
+func MarkNotifiersReady(count int) {
+	health.Lock()
+	defer health.Unlock()
+	health.notifiers, health.notified = count, true
+}
+
+func (h *healthState) watchFile(filename string, interval time.Duration) {
+	h.Lock()
+	defer h.Unlock()
+	if _, ok := h.files[filename]; !ok {
+		h.files[filename] = false
+	}
+	if interval > h.interval {
+		h.interval = interval
+	}
+}
+
+func (h *healthState) fileLoaded(filename string) {
+	h.Lock()
+	defer h.Unlock()
+	h.files[filename] = true
+}
+
+func (h *healthState) tick() {
+	h.Lock()
+	defer h.Unlock()
+	h.lastTick = time.Now()
+}
+
+// alive returns an error when no scheduled run happened within the
+// longest watch file interval
+func (h *healthState) alive() error {
+	h.Lock()
+	defer h.Unlock()
+	if h.interval == 0 {
+		return nil
+	}
+	last := h.lastTick
+	if last.IsZero() {
+		last = h.started
+	}
+	if since := time.Since(last); since > h.interval+tickGrace {
+		return fmt.Errorf("no scheduled run for %v, interval is %v", since.Round(time.Second), h.interval)
+	}
+	return nil
+}
+
+// ready returns an error naming what has not finished loading
+func (h *healthState) ready() error {
+	h.Lock()
+	defer h.Unlock()
+	var pending []string
+	for filename, loaded := range h.files {
+		if !loaded {
+			pending = append(pending, "watch file "+filename)
+		}
+	}
+	sort.Strings(pending)
+	if len(h.files) == 0 {
+		pending = append(pending, "no watch files")
+	}
+	if !h.notified || h.notifiers == 0 {
+		pending = append(pending, "notifiers")
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("not ready: %s", strings.Join(pending, ", "))
+	}
+	return nil
+}
+
+func healthHandler(check func() error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if err := check(); err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintln(w, err)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	}
+}
@@ -0,0 +1,49 @@
+package feednotifier
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHealthEndpoints(t *testing.T) {
+	defer func(h *healthState) { health = h }(health)
+	health = &healthState{started: time.Now(), files: make(map[string]bool)}
+	ts := httptest.NewServer(newServeMux())
+	defer ts.Close()
+	get := func(path string) (int, string) {
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	health.watchFile("test/watchfile.txt", 30*time.Minute)
+	if code, body := get("/readyz"); code != http.StatusServiceUnavailable || !strings.Contains(body, "watch file test/watchfile.txt, notifiers") {
+		t.Errorf("expected not ready, got %d %s", code, body)
+	}
+	health.fileLoaded("test/watchfile.txt")
+	MarkNotifiersReady(1)
+	if code, body := get("/readyz"); code != http.StatusOK {
+		t.Errorf("expected ready, got %d %s", code, body)
+	}
+
+	if code, body := get("/healthz"); code != http.StatusOK {
+		t.Errorf("expected healthy, got %d %s", code, body)
+	}
+	// the scheduler stopped ticking
+	health.lastTick = time.Now().Add(-time.Hour)
+	if code, body := get("/healthz"); code != http.StatusServiceUnavailable || !strings.Contains(body, "no scheduled run") {
+		t.Errorf("expected unhealthy, got %d %s", code, body)
+	}
+	health.tick()
+	if code, _ := get("/healthz"); code != http.StatusOK {
+		t.Errorf("expected healthy after a run, got %d", code)
+	}
+}
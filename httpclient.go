@@ -0,0 +1,244 @@
+package feednotifier
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HTTPOptions configure the client feeds are fetched with. Feeds override
+// them with the options
+//
+//	timeout=DURATION connect-timeout=DURATION proxy=URL|none ca=FILE
+//	insecure=true user-agent=UA header.NAME=VALUE cookie.NAME=VALUE
+type HTTPOptions struct {
+	// Timeout limits a whole request including reading the body
+	Timeout time.Duration
+	// ConnectTimeout limits connecting and the TLS handshake
+	ConnectTimeout time.Duration
+	// Proxy is an http, https or socks5 url; "" uses the HTTP_PROXY,
+	// HTTPS_PROXY and NO_PROXY environment and none disables proxies
+	Proxy string
+	// CAFile is a PEM bundle trusted in addition to the system roots
+	CAFile string
+	// Insecure skips verifying server certificates
+	Insecure  bool
+	UserAgent string
+	// Headers are "Name: value" and Cookies "name=value". They are only
+	// sent to HeaderHosts, path.Match patterns of host names such as
+	// *.example.com, so credentials don't reach other sites.
+	Headers     []string
+	Cookies     []string
+	HeaderHosts []string
+}
+
+// defaultUserAgent is sent unless another is configured; some sites refuse
+// requests without a browser like user agent
+const defaultUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:73.0) Gecko/20100101 Firefox/73.0"
+
+// httpSettings are HTTPOptions after parsing
+type httpSettings struct {
+	timeout        time.Duration
+	connectTimeout time.Duration
+	proxy          string
+	caFile         string
+	insecure       bool
+	userAgent      string
+	// headers and cookies are sent to hosts matching headerHosts, those of
+	// a feed's options to the feed
+	headers     http.Header
+	cookies     []*http.Cookie
+	headerHosts []string
+	feedHeaders http.Header
+	feedCookies []*http.Cookie
+}
+
+var globalHTTP = httpSettings{
+	timeout:        2 * time.Minute,
+	connectTimeout: 30 * time.Second,
+	userAgent:      defaultUserAgent,
+	headers:        make(http.Header),
+}
+
+// httpClients are shared by all feeds with the same transport settings so
+// connections are reused
+var httpClients struct {
+	sync.Mutex
+	byKey map[string]*http.Client
+}
+
+// SetHTTPOptions sets the client settings of feeds that don't override them;
+// zero durations and an empty user agent keep the defaults
+func SetHTTPOptions(o HTTPOptions) error {
+	s := globalHTTP
+	if o.Timeout > 0 {
+		s.timeout = o.Timeout
+	}
+	if o.ConnectTimeout > 0 {
+		s.connectTimeout = o.ConnectTimeout
+	}
+	if o.UserAgent != "" {
+		s.userAgent = o.UserAgent
+	}
+	s.proxy, s.caFile, s.insecure = o.Proxy, o.CAFile, o.Insecure
+	s.headers = make(http.Header)
+	for _, h := range o.Headers {
+		kv := strings.SplitN(h, ":", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return fmt.Errorf("invalid header %q - expected Name: value", h)
+		}
+		s.headers.Add(strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1]))
+	}
+	s.cookies = nil
+	for _, c := range o.Cookies {
+		kv := strings.SplitN(c, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return fmt.Errorf("invalid cookie %q - expected name=value", c)
+		}
+		s.cookies = append(s.cookies, &http.Cookie{Name: kv[0], Value: kv[1]})
+	}
+	for _, pattern := range o.HeaderHosts {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid header host %q - %v", pattern, err)
+		}
+	}
+	if (len(s.headers) > 0 || len(s.cookies) > 0) && len(o.HeaderHosts) == 0 {
+		return fmt.Errorf("headers and cookies need the hosts they are sent to")
+	}
+	s.headerHosts = o.HeaderHosts
+	if _, err := s.client(); err != nil {
+		return err
+	}
+	globalHTTP = s
+	return nil
+}
+
+// feedHTTPSettings applies a feed's options to the global settings
+func feedHTTPSettings(opts map[string]string) (httpSettings, error) {
+	s := globalHTTP
+	s.feedHeaders, s.feedCookies = make(http.Header), nil
+	for k, v := range opts {
+		var err error
+		switch {
+		case k == "timeout":
+			s.timeout, err = parseDuration(v)
+		case k == "connect-timeout":
+			s.connectTimeout, err = parseDuration(v)
+		case k == "proxy":
+			s.proxy = v
+		case k == "ca":
+			s.caFile = v
+		case k == "insecure":
+			s.insecure = v == "true"
+		case k == "user-agent":
+			s.userAgent = v
+		case strings.HasPrefix(k, "header."):
+			s.feedHeaders.Set(strings.TrimPrefix(k, "header."), v)
+		case strings.HasPrefix(k, "cookie."):
+			s.feedCookies = append(s.feedCookies, &http.Cookie{Name: strings.TrimPrefix(k, "cookie."), Value: v})
+		}
+		if err != nil {
+			return s, fmt.Errorf("invalid %s=%s, %v", k, v, err)
+		}
+	}
+	return s, nil
+}
+
+func (s httpSettings) key() string {
+	return fmt.Sprintf("%v|%v|%s|%s|%v", s.timeout, s.connectTimeout, s.proxy, s.caFile, s.insecure)
+}
+
+// client returns the shared client for the settings, creating it on first
+// use
+func (s httpSettings) client() (*http.Client, error) {
+	httpClients.Lock()
+	defer httpClients.Unlock()
+	if c, ok := httpClients.byKey[s.key()]; ok {
+		return c, nil
+	}
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   s.connectTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout:   s.connectTimeout,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		ExpectContinueTimeout: time.Second,
+		TLSClientConfig:       &tls.Config{InsecureSkipVerify: s.insecure},
+	}
+	switch s.proxy {
+	case "":
+	case "none":
+		transport.Proxy = nil
+	default:
+		u, err := url.Parse(s.proxy)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") || u.Host == "" {
+			return nil, fmt.Errorf("invalid proxy %s - expected an http, https or socks5 url", s.proxy)
+		}
+		transport.Proxy = http.ProxyURL(u)
+	}
+	if s.caFile != "" {
+		pem, err := ioutil.ReadFile(s.caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", s.caFile)
+		}
+		transport.TLSClientConfig.RootCAs = pool
+	}
+	c := &http.Client{Transport: transport, Timeout: s.timeout}
+	if httpClients.byKey == nil {
+		httpClients.byKey = make(map[string]*http.Client)
+	}
+	httpClients.byKey[s.key()] = c
+	return c, nil
+}
+
+// newRequest returns a GET request with the user agent of the settings, the
+// headers and cookies for its host and those of the feed
+func (s httpSettings) newRequest(u string) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", s.userAgent)
+	if s.sendsHeadersTo(req.URL.Hostname()) {
+		for k, v := range s.headers {
+			req.Header[k] = v
+		}
+		for _, c := range s.cookies {
+			req.AddCookie(c)
+		}
+	}
+	for k, v := range s.feedHeaders {
+		req.Header[k] = v
+	}
+	for _, c := range s.feedCookies {
+		req.AddCookie(c)
+	}
+	return req, nil
+}
+
+func (s httpSettings) sendsHeadersTo(host string) bool {
+	for _, pattern := range s.headerHosts {
+		if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(host)); ok {
+			return true
+		}
+	}
+	return false
+}
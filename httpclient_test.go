@@ -0,0 +1,148 @@
+package feednotifier
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFetchHeaders(t *testing.T) {
+	var got *http.Request
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+	}))
+	defer ts.Close()
+	saved := globalHTTP
+	defer func() { globalHTTP = saved }()
+
+	r, err := fetch(ts.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Body.Close()
+	if ua := got.Header.Get("User-Agent"); ua != defaultUserAgent {
+		t.Errorf("expected the default user agent, got %s", ua)
+	}
+
+	err = SetHTTPOptions(HTTPOptions{
+		UserAgent:   "feednotifier",
+		Headers:     []string{"Authorization: Bearer abc"},
+		Cookies:     []string{"session=1"},
+		HeaderHosts: []string{"*.example.com", "127.0.0.1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err = fetch(ts.URL, map[string]string{"header.X-Api-Key": "k", "cookie.lang": "en"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Body.Close()
+	if ua := got.Header.Get("User-Agent"); ua != "feednotifier" {
+		t.Errorf("expected the configured user agent, got %s", ua)
+	}
+	if got.Header.Get("Authorization") != "Bearer abc" || got.Header.Get("X-Api-Key") != "k" {
+		t.Errorf("expected global and feed headers, got %v", got.Header)
+	}
+	if c, err := got.Cookie("session"); err != nil || c.Value != "1" {
+		t.Errorf("expected the global cookie, got %v", got.Cookies())
+	}
+	if c, err := got.Cookie("lang"); err != nil || c.Value != "en" {
+		t.Errorf("expected the feed cookie, got %v", got.Cookies())
+	}
+	r, _ = fetch(ts.URL, map[string]string{"user-agent": "reader"})
+	r.Body.Close()
+	if ua := got.Header.Get("User-Agent"); ua != "reader" {
+		t.Errorf("expected the feed user agent, got %s", ua)
+	}
+	if _, ok := got.Header["X-Api-Key"]; ok {
+		t.Errorf("feed headers leaked into other feeds")
+	}
+
+	globalHTTP.headerHosts = []string{"*.example.com"}
+	r, _ = fetch(ts.URL, nil)
+	r.Body.Close()
+	if _, ok := got.Header["Authorization"]; ok || len(got.Cookies()) > 0 {
+		t.Errorf("expected headers and cookies to be kept from other hosts, got %v", got.Header)
+	}
+}
+
+func TestFetchTimeout(t *testing.T) {
+	done := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer ts.Close()
+	defer close(done)
+
+	start := time.Now()
+	if _, err := fetch(ts.URL, map[string]string{"timeout": "100ms"}); err == nil {
+		t.Fatal("expected a timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the request to stop after the timeout, took %v", elapsed)
+	}
+	if _, err := fetch(ts.URL, map[string]string{"timeout": "soon"}); err == nil {
+		t.Errorf("expected an error for an invalid timeout")
+	}
+}
+
+func TestFetchTLS(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	dir, _ := ioutil.TempDir("", "feednotifier")
+	defer os.RemoveAll(dir)
+	ca := filepath.Join(dir, "ca.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	ioutil.WriteFile(ca, cert, 0644)
+
+	if _, err := fetch(ts.URL, nil); err == nil {
+		t.Errorf("expected the self signed certificate to be rejected")
+	}
+	for _, opts := range []map[string]string{{"insecure": "true"}, {"ca": ca}} {
+		r, err := fetch(ts.URL, opts)
+		if err != nil {
+			t.Errorf("%v: %v", opts, err)
+			continue
+		}
+		r.Body.Close()
+	}
+}
+
+func TestSetHTTPOptions(t *testing.T) {
+	saved := globalHTTP
+	defer func() { globalHTTP = saved }()
+	for _, o := range []HTTPOptions{
+		{Proxy: "ftp://proxy"},
+		{Proxy: "socks5://"},
+		{CAFile: "test/missing.pem"},
+		{CAFile: "test/first.xml"},
+		{Headers: []string{"Authorization"}, HeaderHosts: []string{"example.com"}},
+		{Cookies: []string{"session"}, HeaderHosts: []string{"example.com"}},
+		{Headers: []string{"Authorization: Bearer abc"}},
+		{Cookies: []string{"session=1"}, HeaderHosts: []string{"[example.com"}},
+	} {
+		if err := SetHTTPOptions(o); err == nil {
+			t.Errorf("expected an error for %+v", o)
+		}
+	}
+	if err := SetHTTPOptions(HTTPOptions{Proxy: "socks5://localhost:1080", Timeout: time.Second}); err != nil {
+		t.Fatal(err)
+	}
+	if globalHTTP.timeout != time.Second || globalHTTP.connectTimeout != saved.connectTimeout {
+		t.Errorf("unexpected settings %+v", globalHTTP)
+	}
+	a, _ := globalHTTP.client()
+	b, _ := globalHTTP.client()
+	if a != b {
+		t.Errorf("expected the client to be shared")
+	}
+}
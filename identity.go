@@ -0,0 +1,123 @@
+package feednotifier
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// identity returns the key two versions of a feed are compared by; items
+// with the same key are the same item
+type identity func(item *gofeed.Item) string
+
+// identity strategies, set with the id=<strategy> feed option
+const (
+	idAuto           = "auto"
+	idGUID           = "guid"
+	idLink           = "link"
+	idTitlePublished = "title+published"
+	idHash           = "hash"
+)
+
+// hashFields are hashed by id=hash and may be picked with id=hash:f1,f2
+var hashFields = map[string]func(item *gofeed.Item) string{
+	"guid":        func(item *gofeed.Item) string { return item.GUID },
+	"title":       func(item *gofeed.Item) string { return item.Title },
+	"link":        func(item *gofeed.Item) string { return item.Link },
+	"description": func(item *gofeed.Item) string { return item.Description },
+	"content":     func(item *gofeed.Item) string { return item.Content },
+	"published":   func(item *gofeed.Item) string { return item.Published },
+	"updated":     func(item *gofeed.Item) string { return item.Updated },
+}
+
+var defaultHashFields = []string{"title", "link", "description", "published"}
+
+// parseIdentity parses the id option of a feed:
+//
+//	auto             guid, falling back to link and then a content hash
+//	guid             the item guid
+//	link             the item link
+//	title+published  title and publish date
+//	hash[:f1,f2]     a hash of title, link, description and published or
+//	                 of the listed fields
+//	ns:name          an extension element, e.g. torrent:infoHash
+//
+// Items for which the strategy gives no key fall back to auto.
+func parseIdentity(spec string) (identity, error) {
+	var key identity
+	switch {
+	case spec == "" || spec == idAuto:
+		return autoIdentity, nil
+	case spec == idGUID:
+		key = func(item *gofeed.Item) string { return item.GUID }
+	case spec == idLink:
+		key = func(item *gofeed.Item) string { return item.Link }
+	case spec == idTitlePublished:
+		key = func(item *gofeed.Item) string {
+			if item.Title == "" || item.Published == "" {
+				return ""
+			}
+			return item.Title + "\x00" + item.Published
+		}
+	case spec == idHash || strings.HasPrefix(spec, idHash+":"):
+		fields := defaultHashFields
+		if spec != idHash {
+			fields = splitList(strings.TrimPrefix(spec, idHash+":"))
+		}
+		for _, f := range fields {
+			if hashFields[f] == nil {
+				return nil, fmt.Errorf("unknown hash field %s", f)
+			}
+		}
+		key = func(item *gofeed.Item) string { return contentHash(item, fields) }
+	case strings.Count(spec, ":") == 1 && !strings.HasPrefix(spec, ":") && !strings.HasSuffix(spec, ":"):
+		parts := strings.SplitN(spec, ":", 2)
+		key = func(item *gofeed.Item) string {
+			return (&FeedItem{Item: item}).Ext(parts[0], parts[1])
+		}
+	default:
+		return nil, fmt.Errorf("unknown id strategy %s", spec)
+	}
+	return func(item *gofeed.Item) string {
+		if k := key(item); k != "" {
+			return spec + ":" + k
+		}
+		return autoIdentity(item)
+	}, nil
+}
+
+// autoIdentity uses the guid, then the link, then a hash of the content
+func autoIdentity(item *gofeed.Item) string {
+	if item.GUID != "" {
+		return "guid:" + item.GUID
+	}
+	if item.Link != "" {
+		return "link:" + item.Link
+	}
+	return "hash:" + contentHash(item, defaultHashFields)
+}
+
+func contentHash(item *gofeed.Item, fields []string) string {
+	h := sha1.New()
+	for _, f := range fields {
+		fmt.Fprintf(h, "%s\x00", hashFields[f](item))
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// usesGUID reports whether the xslt transforms, which match items by guid,
+// agree with the feed's identity strategy
+func usesGUID(spec string) bool {
+	return spec == "" || spec == idAuto || spec == idGUID
+}
+
+func missingGUID(items []*gofeed.Item) bool {
+	for _, item := range items {
+		if item.GUID == "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package feednotifier
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func TestParseIdentity(t *testing.T) {
+	item := &gofeed.Item{Title: "Title", Link: "https://example.com/1", Published: "Thu, 04 Jan 2018"}
+	tests := []struct {
+		spec, want string
+	}{
+		{"", "link:https://example.com/1"},
+		{"guid", "link:https://example.com/1"},
+		{"link", "link:https://example.com/1"},
+		{"title+published", "title+published:Title\x00Thu, 04 Jan 2018"},
+		{"torrent:infoHash", "link:https://example.com/1"},
+	}
+	for _, test := range tests {
+		key, err := parseIdentity(test.spec)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.spec, err)
+			continue
+		}
+		if got := key(item); got != test.want {
+			t.Errorf("%s: expected %q, got %q", test.spec, test.want, got)
+		}
+	}
+	for _, spec := range []string{"hash:title,bogus", "nonsense", "a:b:c"} {
+		if _, err := parseIdentity(spec); err == nil {
+			t.Errorf("%s: expected error", spec)
+		}
+	}
+
+	titleOnly, _ := parseIdentity("hash:title")
+	other := &gofeed.Item{Title: "Title", Link: "https://mirror.example.com/1"}
+	if titleOnly(item) != titleOnly(other) {
+		t.Errorf("expected hash of selected fields to ignore the link")
+	}
+	if autoIdentity(&gofeed.Item{Title: "a"}) == autoIdentity(&gofeed.Item{Title: "b"}) {
+		t.Errorf("expected content hash fallback to tell items apart")
+	}
+}
+
+func TestCompareFeedsInProcIdentity(t *testing.T) {
+	tests := []struct {
+		spec string
+		want []string
+	}{
+		// without guids items are matched by link; the mirror link of S09E09 is new
+		{"auto", []string{"S09E11", "S09E10", "S09E09"}},
+		{"torrent:infoHash", []string{"S09E11", "S09E10"}},
+		{"title+published", []string{"S09E11", "S09E10"}},
+	}
+	for _, test := range tests {
+		key, _ := parseIdentity(test.spec)
+		diff, err := compareFeedsInProc("test/noguid.first.xml", "test/noguid.second.xml", key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(diff.Items) != len(test.want) {
+			t.Errorf("%s: expected %d new items, got %d", test.spec, len(test.want), len(diff.Items))
+			continue
+		}
+		for i, item := range diff.Items {
+			if !strings.Contains(item.Title, test.want[i]) {
+				t.Errorf("%s: expected %s in position %d, got %s", test.spec, test.want[i], i, item.Title)
+			}
+		}
+	}
+}
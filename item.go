@@ -0,0 +1,62 @@
+package feednotifier
+
+import (
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// FeedItem is a new item found in a feed along with where it came from.
+// The gofeed item is embedded so templates can keep using {{.Title}},
+// {{.Link}} etc.
+type FeedItem struct {
+	*gofeed.Item
+	Feed    *gofeed.Feed
+	FeedURL string
+	Label   string
+	Tags    []string
+	// WatchFile is the watch file the feed is listed in
+	WatchFile string
+	// Liked is set when the title matches a "more like this" choice
+	Liked bool
+	// Downloaded is set when the item was added to the feed's download client
+	Downloaded bool
+	// Episode is parsed from the title of tv releases, nil for other items
+	Episode *Episode
+	// Previous is the version of an updated item sent before
+	Previous *gofeed.Item
+}
+
+func newFeedItem(feed *gofeed.Feed, item *gofeed.Item, value FeedUrl) *FeedItem {
+	return &FeedItem{
+		Item:      item,
+		Feed:      feed,
+		FeedURL:   value.url,
+		Label:     value.opts["label"],
+		Tags:      splitList(value.opts["tags"]),
+		WatchFile: value.file,
+		Episode:   ParseEpisode(item.Title),
+	}
+}
+
+// Ext returns the first value of the extension element ns:name, or ""
+func (i *FeedItem) Ext(ns, name string) string {
+	if i.Item == nil || i.Extensions == nil {
+		return ""
+	}
+	if values := i.Extensions[ns][name]; len(values) > 0 {
+		return values[0].Value
+	}
+	return ""
+}
+
+// splitList splits a comma separated option value
+func splitList(value string) []string {
+	var list []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
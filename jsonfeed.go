@@ -0,0 +1,269 @@
+package feednotifier
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// feed formats as detected by detectFormat
+const (
+	feedRSS     = "rss"
+	feedAtom    = "atom"
+	feedJSON    = "json"
+	feedUnknown = ""
+)
+
+// jsonFeedDoc is a JSON Feed document, version 1.0 or 1.1
+type jsonFeedDoc struct {
+	Version     string `json:"version"`
+	Title       string `json:"title"`
+	HomePageURL string `json:"home_page_url"`
+	FeedURL     string `json:"feed_url"`
+	Description string `json:"description"`
+	Icon        string `json:"icon"`
+	Language    string `json:"language"`
+	// Author is from version 1.0, Authors from 1.1
+	Author  *jsonFeedAuthor   `json:"author"`
+	Authors []jsonFeedAuthor  `json:"authors"`
+	Items   []jsonFeedDocItem `json:"items"`
+}
+
+type jsonFeedDocItem struct {
+	ID            json.RawMessage         `json:"id"`
+	URL           string                  `json:"url"`
+	ExternalURL   string                  `json:"external_url"`
+	Title         string                  `json:"title"`
+	ContentHTML   string                  `json:"content_html"`
+	ContentText   string                  `json:"content_text"`
+	Summary       string                  `json:"summary"`
+	Image         string                  `json:"image"`
+	DatePublished string                  `json:"date_published"`
+	DateModified  string                  `json:"date_modified"`
+	Author        *jsonFeedAuthor         `json:"author"`
+	Authors       []jsonFeedAuthor        `json:"authors"`
+	Tags          []string                `json:"tags"`
+	Attachments   []jsonFeedDocAttachment `json:"attachments"`
+}
+
+type jsonFeedDocAttachment struct {
+	URL         string `json:"url"`
+	MimeType    string `json:"mime_type"`
+	SizeInBytes int64  `json:"size_in_bytes"`
+}
+
+// jsonFeedOut, jsonFeedOutItem and jsonFeedOutAttachment are the documents
+// written by marshalJSONFeed, leaving out empty members
+type jsonFeedOut struct {
+	Version     string            `json:"version"`
+	Title       string            `json:"title"`
+	HomePageURL string            `json:"home_page_url,omitempty"`
+	FeedURL     string            `json:"feed_url,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Language    string            `json:"language,omitempty"`
+	Authors     []jsonFeedAuthor  `json:"authors,omitempty"`
+	Items       []jsonFeedOutItem `json:"items"`
+}
+
+type jsonFeedOutItem struct {
+	ID            string                  `json:"id"`
+	URL           string                  `json:"url,omitempty"`
+	Title         string                  `json:"title"`
+	ContentHTML   string                  `json:"content_html,omitempty"`
+	Summary       string                  `json:"summary,omitempty"`
+	Image         string                  `json:"image,omitempty"`
+	DatePublished string                  `json:"date_published,omitempty"`
+	DateModified  string                  `json:"date_modified,omitempty"`
+	Authors       []jsonFeedAuthor        `json:"authors,omitempty"`
+	Tags          []string                `json:"tags,omitempty"`
+	Attachments   []jsonFeedOutAttachment `json:"attachments,omitempty"`
+}
+
+type jsonFeedOutAttachment struct {
+	URL         string `json:"url"`
+	MimeType    string `json:"mime_type,omitempty"`
+	SizeInBytes int64  `json:"size_in_bytes,omitempty"`
+}
+
+// detectFormat sniffs the format of a feed document
+func detectFormat(content []byte) string {
+	trimmed := bytes.TrimLeft(content, "\xef\xbb\xbf \t\r\n")
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		return feedJSON
+	}
+	switch gofeed.DetectFeedType(bytes.NewReader(content)) {
+	case gofeed.FeedTypeRSS:
+		return feedRSS
+	case gofeed.FeedTypeAtom:
+		return feedAtom
+	}
+	return feedUnknown
+}
+
+// feedFormat returns the format of the feed saved in fn
+func feedFormat(fn string) string {
+	fh, err := os.Open(fn)
+	if err != nil {
+		return feedUnknown
+	}
+	defer fh.Close()
+	head, _ := bufio.NewReader(fh).Peek(4096)
+	return detectFormat(head)
+}
+
+// ParseFeed parses an RSS, Atom or JSON Feed document into the common
+// gofeed model
+func ParseFeed(r io.Reader) (*gofeed.Feed, error) {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(512)
+	if detectFormat(head) == feedJSON {
+		return parseJSONFeed(br)
+	}
+	return gofeed.NewParser().Parse(br)
+}
+
+func parseJSONFeed(r io.Reader) (*gofeed.Feed, error) {
+	var doc jsonFeedDoc
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid json feed, %v", err)
+	}
+	if !strings.HasPrefix(doc.Version, "https://jsonfeed.org/version/") {
+		return nil, fmt.Errorf("unknown json feed version %q", doc.Version)
+	}
+	feed := &gofeed.Feed{
+		Title:       doc.Title,
+		Description: doc.Description,
+		Link:        doc.HomePageURL,
+		FeedLink:    doc.FeedURL,
+		Language:    doc.Language,
+		Author:      jsonFeedPerson(doc.Author, doc.Authors),
+		FeedType:    feedJSON,
+		FeedVersion: strings.TrimPrefix(doc.Version, "https://jsonfeed.org/version/"),
+		Items:       make([]*gofeed.Item, 0, len(doc.Items)),
+	}
+	if doc.Icon != "" {
+		feed.Image = &gofeed.Image{URL: doc.Icon}
+	}
+	for _, i := range doc.Items {
+		item := &gofeed.Item{
+			GUID:        jsonFeedID(i.ID),
+			Link:        i.URL,
+			Title:       i.Title,
+			Description: i.Summary,
+			Content:     i.ContentHTML,
+			Published:   i.DatePublished,
+			Updated:     i.DateModified,
+			Author:      jsonFeedPerson(i.Author, i.Authors),
+			Categories:  i.Tags,
+		}
+		if item.Link == "" {
+			item.Link = i.ExternalURL
+		}
+		if item.Content == "" {
+			item.Content = i.ContentText
+		}
+		if t, err := time.Parse(time.RFC3339, i.DatePublished); err == nil {
+			item.PublishedParsed = &t
+		}
+		if t, err := time.Parse(time.RFC3339, i.DateModified); err == nil {
+			item.UpdatedParsed = &t
+		}
+		if i.Image != "" {
+			item.Image = &gofeed.Image{URL: i.Image}
+		}
+		for _, a := range i.Attachments {
+			item.Enclosures = append(item.Enclosures, &gofeed.Enclosure{
+				URL:    a.URL,
+				Type:   a.MimeType,
+				Length: fmt.Sprintf("%d", a.SizeInBytes),
+			})
+		}
+		feed.Items = append(feed.Items, item)
+	}
+	return feed, nil
+}
+
+// marshalJSONFeed writes a feed as a JSON Feed 1.1 document; sources other
+// than feed documents are saved this way
+func marshalJSONFeed(feed *gofeed.Feed) ([]byte, error) {
+	doc := jsonFeedOut{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       feed.Title,
+		HomePageURL: feed.Link,
+		FeedURL:     feed.FeedLink,
+		Description: feed.Description,
+		Language:    feed.Language,
+		Items:       make([]jsonFeedOutItem, 0, len(feed.Items)),
+	}
+	if feed.Author != nil && feed.Author.Name != "" {
+		doc.Authors = []jsonFeedAuthor{{Name: feed.Author.Name}}
+	}
+	for _, item := range feed.Items {
+		id := item.GUID
+		if id == "" {
+			id = item.Link
+		}
+		if id == "" {
+			id = contentHash(item, defaultHashFields)
+		}
+		i := jsonFeedOutItem{
+			ID:            id,
+			URL:           item.Link,
+			Title:         item.Title,
+			ContentHTML:   item.Content,
+			Summary:       item.Description,
+			DatePublished: jsonFeedDate(item.Published, item.PublishedParsed),
+			DateModified:  jsonFeedDate(item.Updated, item.UpdatedParsed),
+			Tags:          item.Categories,
+		}
+		if item.Author != nil && item.Author.Name != "" {
+			i.Authors = []jsonFeedAuthor{{Name: item.Author.Name}}
+		}
+		if item.Image != nil {
+			i.Image = item.Image.URL
+		}
+		for _, e := range item.Enclosures {
+			size, _ := strconv.ParseInt(e.Length, 10, 64)
+			i.Attachments = append(i.Attachments, jsonFeedOutAttachment{URL: e.URL, MimeType: e.Type, SizeInBytes: size})
+		}
+		doc.Items = append(doc.Items, i)
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// jsonFeedDate formats a parsed date as RFC 3339 and keeps unparsed ones as
+// they are
+func jsonFeedDate(text string, parsed *time.Time) string {
+	if parsed != nil {
+		return parsed.Format(time.RFC3339)
+	}
+	return text
+}
+
+// jsonFeedID returns an item id; the spec asks for a string but some feeds
+// use numbers
+func jsonFeedID(raw json.RawMessage) string {
+	var id string
+	if err := json.Unmarshal(raw, &id); err == nil {
+		return id
+	}
+	return strings.TrimSpace(string(raw))
+}
+
+func jsonFeedPerson(author *jsonFeedAuthor, authors []jsonFeedAuthor) *gofeed.Person {
+	if len(authors) > 0 {
+		author = &authors[0]
+	}
+	if author == nil || author.Name == "" {
+		return nil
+	}
+	return &gofeed.Person{Name: author.Name}
+}
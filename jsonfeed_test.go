@@ -0,0 +1,73 @@
+package feednotifier
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDetectFormat(t *testing.T) {
+	tests := map[string]string{
+		"test/first.xml":           feedRSS,
+		"test/atom.first.xml":      feedAtom,
+		"test/jsonfeed.first.json": feedJSON,
+		"test/empty":               feedUnknown,
+	}
+	for fn, want := range tests {
+		if got := feedFormat(fn); got != want {
+			t.Errorf("%s: expected %q, got %q", fn, want, got)
+		}
+	}
+}
+
+func TestParseJSONFeed(t *testing.T) {
+	feed, err := parseFeedFile("test/jsonfeed.second.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feed.Title != "Example blog" || feed.FeedType != feedJSON || feed.FeedVersion != "1.1" || len(feed.Items) != 3 {
+		t.Fatalf("unexpected feed %s", feed)
+	}
+	podcast := feed.Items[0]
+	if podcast.GUID != "3" || podcast.Link != "https://example.org/podcast-1" || podcast.Description != "Our first episode" ||
+		podcast.Content != "<p>Listen</p>" || podcast.PublishedParsed == nil || podcast.Categories[0] != "podcast" {
+		t.Errorf("unexpected item %+v", podcast)
+	}
+	if len(podcast.Enclosures) != 1 || podcast.Enclosures[0].Type != "audio/mpeg" || podcast.Enclosures[0].Length != "1024" {
+		t.Errorf("expected attachment as enclosure, got %v", podcast.Enclosures)
+	}
+	first := feed.Items[2]
+	if first.Content != "First, with corrections" || first.Updated != "2020-03-03T09:00:00Z" || first.UpdatedParsed == nil {
+		t.Errorf("expected content_text and date_modified to be mapped, got %+v", first)
+	}
+	if _, err := ParseFeed(strings.NewReader(`{"version": "1", "items": []}`)); err == nil {
+		t.Errorf("expected unknown version to fail")
+	}
+}
+
+func TestCompareAtomAndJSONFeeds(t *testing.T) {
+	tests := []struct {
+		first, second string
+		added         string
+		updated       string
+	}{
+		{"test/atom.first.xml", "test/atom.second.xml", "Version 1.2", "Version 1.1"},
+		{"test/jsonfeed.first.json", "test/jsonfeed.second.json", "Podcast episode", "First post (revised)"},
+	}
+	for _, test := range tests {
+		// entries share a link, so they must be told apart by id
+		diff, err := compareFeedsInProc(test.first, test.second, autoIdentity)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(diff.Items) != 1 || diff.Items[0].Title != test.added {
+			t.Errorf("%s: expected only %s as new, got %d items", test.second, test.added, len(diff.Items))
+		}
+		updates, err := compareUpdates(FeedUrl{url: "https://example.org/feed"}, test.first, test.second, autoIdentity)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(updates) != 1 || updates[0].Title != test.updated {
+			t.Errorf("%s: expected %s as update, got %d items", test.second, test.updated, len(updates))
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package feednotifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// jsonPath is a compiled path into a decoded json document. It supports the
+// commonly used part of JSONPath and the jq equivalents:
+//
+//	$ or .            the document, or the item for item fields
+//	.name ['name']    a member of an object
+//	[2]               an element of an array; negative counts from the end
+//	[*] [] .*         every element or member
+//	..name            name at any depth
+type jsonPath []pathStep
+
+type pathStep struct {
+	name      string
+	index     int
+	kind      stepKind
+	recursive bool
+}
+
+type stepKind int
+
+const (
+	stepName stepKind = iota
+	stepIndex
+	stepAll
+)
+
+func parseJSONPath(expr string) (jsonPath, error) {
+	p := strings.TrimSpace(expr)
+	p = strings.TrimPrefix(p, "$")
+	var path jsonPath
+	for p != "" {
+		recursive := false
+		switch {
+		case strings.HasPrefix(p, ".."):
+			recursive = true
+			p = p[2:]
+		case p[0] == '.':
+			p = p[1:]
+		case p[0] == '[':
+		default:
+			if len(path) > 0 {
+				return nil, fmt.Errorf("invalid json path %s at %q", expr, p)
+			}
+		}
+		if p == "" {
+			break
+		}
+		var step pathStep
+		if p[0] == '[' {
+			end := strings.Index(p, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("invalid json path %s - missing ]", expr)
+			}
+			inner := strings.TrimSpace(p[1:end])
+			p = p[end+1:]
+			switch {
+			case inner == "" || inner == "*":
+				step.kind = stepAll
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				step.name = inner[1 : len(inner)-1]
+			default:
+				n, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("invalid json path %s - bad index %s", expr, inner)
+				}
+				step.kind, step.index = stepIndex, n
+			}
+		} else {
+			end := strings.IndexAny(p, ".[")
+			if end < 0 {
+				end = len(p)
+			}
+			step.name, p = p[:end], p[end:]
+			if step.name == "*" {
+				step.kind, step.name = stepAll, ""
+			}
+		}
+		step.recursive = recursive
+		path = append(path, step)
+	}
+	return path, nil
+}
+
+// eval returns every value the path selects from doc
+func (path jsonPath) eval(doc interface{}) []interface{} {
+	values := []interface{}{doc}
+	for _, step := range path {
+		var next []interface{}
+		for _, v := range values {
+			if step.recursive {
+				for _, d := range descendants(v) {
+					next = append(next, step.apply(d)...)
+				}
+			} else {
+				next = append(next, step.apply(v)...)
+			}
+		}
+		values = next
+	}
+	return values
+}
+
+func (step pathStep) apply(v interface{}) []interface{} {
+	switch step.kind {
+	case stepName:
+		if m, ok := v.(map[string]interface{}); ok {
+			if child, ok := m[step.name]; ok {
+				return []interface{}{child}
+			}
+		}
+	case stepIndex:
+		if a, ok := v.([]interface{}); ok {
+			i := step.index
+			if i < 0 {
+				i += len(a)
+			}
+			if i >= 0 && i < len(a) {
+				return []interface{}{a[i]}
+			}
+		}
+	case stepAll:
+		switch c := v.(type) {
+		case []interface{}:
+			return c
+		case map[string]interface{}:
+			var children []interface{}
+			for _, k := range sortedKeys(c) {
+				children = append(children, c[k])
+			}
+			return children
+		}
+	}
+	return nil
+}
+
+// descendants returns v and everything nested in it
+func descendants(v interface{}) []interface{} {
+	all := []interface{}{v}
+	switch c := v.(type) {
+	case []interface{}:
+		for _, child := range c {
+			all = append(all, descendants(child)...)
+		}
+	case map[string]interface{}:
+		for _, k := range sortedKeys(c) {
+			all = append(all, descendants(c[k])...)
+		}
+	}
+	return all
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// jsonString formats the first value as text; objects and arrays are
+// returned as json
+func jsonString(values []interface{}) string {
+	if len(values) == 0 {
+		return ""
+	}
+	switch v := values[0].(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		content, _ := json.Marshal(v)
+		return string(content)
+	}
+}
@@ -0,0 +1,169 @@
+package feednotifier
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	log "github.com/sirupsen/logrus"
+)
+
+// json feeds build items from a json api response with json paths:
+//
+//	items=PATH          the items, e.g. $.releases[*]; defaults to the
+//	                    document when it is an array
+//	item-id=PATH        defaults to the id member; id= picks how items are
+//	                    compared, as for other feeds
+//	title=PATH          defaults to the title member
+//	link=PATH           defaults to the url member
+//	date=PATH           publish date, a timestamp or unix time
+//	date-format=LAYOUT  go time layout of the date
+//	body=PATH           description of the item
+//
+// Item fields are relative to the item, e.g. title=$.name or title=.name
+var jsonFieldDefaults = map[string]string{
+	"item-id": "id",
+	"title":   "title",
+	"link":    "url",
+}
+
+func jsonSource(value FeedUrl) (*gofeed.Feed, error) {
+	r, err := fetch(value.url, value.opts)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	return jsonItems(r.Body, value)
+}
+
+func jsonPaths(value FeedUrl) (map[string]jsonPath, error) {
+	paths := make(map[string]jsonPath)
+	for _, field := range []string{"items", "item-id", "title", "link", "date", "body"} {
+		expr, ok := value.opts[field]
+		if !ok {
+			expr = jsonFieldDefaults[field]
+		}
+		if expr == "" {
+			continue
+		}
+		path, err := parseJSONPath(expr)
+		if err != nil {
+			return nil, err
+		}
+		paths[field] = path
+	}
+	return paths, nil
+}
+
+func jsonItems(r io.Reader, value FeedUrl) (*gofeed.Feed, error) {
+	paths, err := jsonPaths(value)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid json from %s, %v", value.url, err)
+	}
+	var items []interface{}
+	if path, ok := paths["items"]; ok {
+		items = path.eval(doc)
+	} else if a, ok := doc.([]interface{}); ok {
+		items = a
+	} else {
+		return nil, fmt.Errorf("json from %s is not an array - set items to the path of the items", value.url)
+	}
+	return buildJSONFeed(items, paths, value)
+}
+
+// jsonLines builds a feed from one json object per line
+func jsonLines(r io.Reader, value FeedUrl) (*gofeed.Feed, error) {
+	paths, err := jsonPaths(value)
+	if err != nil {
+		return nil, err
+	}
+	var items []interface{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		decoder := json.NewDecoder(strings.NewReader(line))
+		decoder.UseNumber()
+		var item interface{}
+		if err := decoder.Decode(&item); err != nil {
+			return nil, fmt.Errorf("invalid json on line %d from %s, %v", n, value.url, err)
+		}
+		items = append(items, item)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return buildJSONFeed(items, paths, value)
+}
+
+func buildJSONFeed(items []interface{}, paths map[string]jsonPath, value FeedUrl) (*gofeed.Feed, error) {
+	base, _ := url.Parse(value.url)
+	feed := &gofeed.Feed{Title: base.Host, Link: value.url}
+	if feed.Title == "" {
+		feed.Title = value.url
+	}
+	field := func(item interface{}, name string) string {
+		if path, ok := paths[name]; ok {
+			return jsonString(path.eval(item))
+		}
+		return ""
+	}
+	for _, i := range items {
+		item := &gofeed.Item{
+			GUID:        field(i, "item-id"),
+			Title:       field(i, "title"),
+			Description: field(i, "body"),
+		}
+		if link := field(i, "link"); link != "" {
+			if u, err := base.Parse(link); err == nil && base.Host != "" {
+				link = u.String()
+			}
+			item.Link = link
+		}
+		if date := field(i, "date"); date != "" {
+			item.Published = date
+			if t, err := parseJSONDate(date, value.opts["date-format"]); err == nil {
+				item.PublishedParsed = &t
+			} else {
+				log.Warnf("Json feed %s - %v", value.url, err)
+			}
+		}
+		if item.GUID == "" && item.Title == "" && item.Link == "" {
+			continue
+		}
+		feed.Items = append(feed.Items, item)
+	}
+	if len(feed.Items) == 0 {
+		return nil, fmt.Errorf("no items in json from %s", value.url)
+	}
+	return feed, nil
+}
+
+// parseJSONDate parses a date string or a unix time in seconds or
+// milliseconds
+func parseJSONDate(text, layout string) (time.Time, error) {
+	if layout == "" {
+		if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+			if n > 1e12 {
+				return time.Unix(0, n*int64(time.Millisecond)).UTC(), nil
+			}
+			return time.Unix(n, 0).UTC(), nil
+		}
+	}
+	return parseDate(text, layout)
+}
@@ -0,0 +1,112 @@
+package feednotifier
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestJSONPath(t *testing.T) {
+	doc := map[string]interface{}{
+		"data": map[string]interface{}{
+			"items": []interface{}{
+				map[string]interface{}{"name": "a", "tags": []interface{}{"x", "y"}},
+				map[string]interface{}{"name": "b", "tags": []interface{}{"z"}},
+			},
+		},
+	}
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"$.data.items[*].name", "a,b"},
+		{".data.items[].name", "a,b"},
+		{"$['data']['items'][1].name", "b"},
+		{"$.data.items[-1].tags[0]", "z"},
+		{"$..name", "a,b"},
+		{"data.items[0].missing", ""},
+	}
+	for _, test := range tests {
+		path, err := parseJSONPath(test.expr)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		var got []string
+		for _, v := range path.eval(doc) {
+			got = append(got, jsonString([]interface{}{v}))
+		}
+		if strings.Join(got, ",") != test.want {
+			t.Errorf("%s: expected %s, got %v", test.expr, test.want, got)
+		}
+	}
+	for _, expr := range []string{"$.items[", "$.items[x]", "$.a b.c[0]d"} {
+		if _, err := parseJSONPath(expr); err == nil {
+			t.Errorf("%s: expected an error", expr)
+		}
+	}
+}
+
+func TestJSONSource(t *testing.T) {
+	current := "test/releases.first.json"
+	ts := serveFile(&current)
+	defer ts.Close()
+	value := FeedUrl{url: ts.URL + "/repos/acme/tool", opts: map[string]string{
+		"items": "$.releases[*]",
+		"title": "$.name",
+		"link":  ".html_url",
+		"date":  "published_at",
+		"body":  "body",
+	}}
+	feed, err := jsonSource(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feed.Items) != 2 {
+		t.Fatalf("expected 2 releases, got %d", len(feed.Items))
+	}
+	item := feed.Items[0]
+	if item.GUID != "102" || item.Title != "v1.1.0" || item.Link != ts.URL+"/acme/tool/releases/v1.1.0" ||
+		item.Description != "Bug fixes" || item.PublishedParsed == nil || item.PublishedParsed.Day() != 2 {
+		t.Errorf("unexpected item %+v", item)
+	}
+
+	feed, err = jsonItems(strings.NewReader(`[{"id": 1, "title": "one", "url": "https://example.org/1", "created": 1583143200000}]`),
+		FeedUrl{url: "https://example.org/api", opts: map[string]string{"date": "created"}})
+	if err != nil || len(feed.Items) != 1 || feed.Items[0].PublishedParsed == nil || feed.Items[0].PublishedParsed.Year() != 2020 {
+		t.Errorf("expected default fields and a unix time in milliseconds, got %v", err)
+	}
+	feed, err = jsonItems(strings.NewReader(`[{"id": 1, "title": "one", "url": "https://example.org/1"}]`),
+		FeedUrl{url: "https://example.org/api", opts: map[string]string{"item-id": "$.url", "id": "link"}})
+	if err != nil || feed.Items[0].GUID != "https://example.org/1" {
+		t.Errorf("expected item-id to pick the id and id to be left to the identity, got %v", err)
+	}
+	if _, err := jsonItems(strings.NewReader(`{"releases": []}`), FeedUrl{url: "https://example.org/api"}); err == nil {
+		t.Errorf("expected an error for an object without an items path")
+	}
+}
+
+func TestProcessLineJSON(t *testing.T) {
+	initTemplates()
+	current := "test/releases.first.json"
+	ts := serveFile(&current)
+	defer ts.Close()
+	dir, _ := ioutil.TempDir("", "feednotifier")
+	defer os.RemoveAll(dir)
+
+	out := &bytes.Buffer{}
+	notifiers := []Notifier{NewDryRunNotifier(newPushover("abc", "def"), out)}
+	value := FeedUrl{url: ts.URL, savePath: filepath.Join(dir, "base"), basedir: dir, opts: map[string]string{
+		"type": "json", "items": "$.releases[*]", "title": "name", "link": "html_url",
+	}}
+	processLine(ts.URL, value, notifiers)
+	current = "test/releases.second.json"
+	out.Reset()
+	processLine(ts.URL, value, notifiers)
+	if n := strings.Count(out.String(), "template: __message"); n != 1 || !strings.Contains(out.String(), "v1.2.0") {
+		t.Errorf("expected only the new release to be sent, got %s", out.String())
+	}
+}
@@ -0,0 +1,112 @@
+package feednotifier
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	log "github.com/sirupsen/logrus"
+)
+
+// defaults for the max-items-per-run and max-age feed options; zero means
+// no limit
+var (
+	maxItemsPerRun int
+	maxItemAge     time.Duration
+)
+
+// SetItemLimits sets how many items a feed may send per run and how old an
+// item may be, in days, for feeds that don't set max-items-per-run or max-age
+func SetItemLimits(maxItems, maxAgeDays int) {
+	maxItemsPerRun = maxItems
+	maxItemAge = time.Duration(maxAgeDays) * 24 * time.Hour
+}
+
+// intOption returns a numeric feed option, or def when it isn't set
+func intOption(value FeedUrl, name string, def int) int {
+	v, ok := value.opts[name]
+	if !ok {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		log.Warnf("Ignoring invalid %s=%s for %s", name, v, value.url)
+		return def
+	}
+	return n
+}
+
+// ageOption returns the max-age of a feed; a plain number is in days
+func ageOption(value FeedUrl) time.Duration {
+	v, ok := value.opts["max-age"]
+	if !ok {
+		return maxItemAge
+	}
+	if days, err := strconv.Atoi(v); err == nil {
+		v = fmt.Sprintf("%dd", days)
+	}
+	age, err := parseDuration(v)
+	if err != nil || age < 0 {
+		log.Warnf("Ignoring invalid max-age=%s for %s", v, value.url)
+		return maxItemAge
+	}
+	return age
+}
+
+// itemTime is when an item was published or last updated, zero if the feed
+// doesn't say
+func itemTime(item *gofeed.Item) time.Time {
+	if item.PublishedParsed != nil {
+		return *item.PublishedParsed
+	}
+	if item.UpdatedParsed != nil {
+		return *item.UpdatedParsed
+	}
+	return time.Time{}
+}
+
+// dropOldItems drops items published longer than the feed's max-age ago;
+// undated items are kept
+func dropOldItems(items []*gofeed.Item, value FeedUrl) []*gofeed.Item {
+	maxAge := ageOption(value)
+	if maxAge == 0 {
+		return items
+	}
+	cutoff := time.Now().Add(-maxAge)
+	kept := items[:0]
+	for _, item := range items {
+		if t := itemTime(item); !t.IsZero() && t.Before(cutoff) {
+			log.Infof("Skipping item %s from feed %s - published %v", item.Title, value.url, t)
+			continue
+		}
+		kept = append(kept, item)
+	}
+	return kept
+}
+
+// latestItems keeps the max most recent items, in feed order; undated items
+// count as older than dated ones. A max of zero keeps all items.
+func latestItems(items []*FeedItem, max int, value FeedUrl) []*FeedItem {
+	if max == 0 || len(items) <= max {
+		return items
+	}
+	newest := make([]*FeedItem, len(items))
+	copy(newest, items)
+	sort.SliceStable(newest, func(i, j int) bool {
+		return itemTime(newest[i].Item).After(itemTime(newest[j].Item))
+	})
+	keep := make(map[*FeedItem]bool, max)
+	for _, item := range newest[:max] {
+		keep[item] = true
+	}
+	kept := items[:0]
+	for _, item := range items {
+		if keep[item] {
+			kept = append(kept, item)
+		}
+	}
+	log.Warnf("Feed %s has %d new items - only sending the latest %d", value.url, len(items), max)
+	return kept
+}
@@ -0,0 +1,84 @@
+package feednotifier
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func datedItem(title string, age time.Duration) *gofeed.Item {
+	item := &gofeed.Item{Title: title}
+	if age > 0 {
+		published := time.Now().Add(-age)
+		item.PublishedParsed = &published
+	}
+	return item
+}
+
+func TestDropOldItems(t *testing.T) {
+	defer SetItemLimits(0, 0)
+	SetItemLimits(0, 7)
+	items := []*gofeed.Item{
+		datedItem("new", time.Hour),
+		datedItem("old", 30*24*time.Hour),
+		datedItem("undated", 0),
+	}
+	value := FeedUrl{url: "https://example.com/rss"}
+	if kept := dropOldItems(append([]*gofeed.Item{}, items...), value); len(kept) != 2 || kept[1].Title != "undated" {
+		t.Errorf("expected old item to be dropped, got %d items", len(kept))
+	}
+	value.opts = map[string]string{"max-age": "60"}
+	if kept := dropOldItems(append([]*gofeed.Item{}, items...), value); len(kept) != 3 {
+		t.Errorf("expected feed max-age to override the default, got %d items", len(kept))
+	}
+	value.opts = map[string]string{"max-age": "30m"}
+	if kept := dropOldItems(append([]*gofeed.Item{}, items...), value); len(kept) != 1 {
+		t.Errorf("expected durations to be accepted, got %d items", len(kept))
+	}
+}
+
+func TestLatestItems(t *testing.T) {
+	value := FeedUrl{url: "https://example.com/rss"}
+	var items []*FeedItem
+	for _, item := range []*gofeed.Item{
+		datedItem("undated", 0),
+		datedItem("2h", 2*time.Hour),
+		datedItem("3d", 72*time.Hour),
+		datedItem("1h", time.Hour),
+	} {
+		items = append(items, &FeedItem{Item: item})
+	}
+	kept := latestItems(items, 2, value)
+	if len(kept) != 2 || kept[0].Title != "2h" || kept[1].Title != "1h" {
+		t.Errorf("expected the 2 latest items in feed order, got %v", itemTitles(kept))
+	}
+	if kept := latestItems(items[:1], 0, value); len(kept) != 1 {
+		t.Errorf("expected no limit for 0")
+	}
+	if n := intOption(FeedUrl{opts: map[string]string{"max-items-per-run": "x"}}, "max-items-per-run", 5); n != 5 {
+		t.Errorf("expected default for invalid option, got %d", n)
+	}
+}
+
+func TestLatestItemsAfterDedupe(t *testing.T) {
+	defer func(keys []string, window time.Duration) { dedupeKeys, dedupeWindow = keys, window }(dedupeKeys, dedupeWindow)
+	SetDedupe([]string{"title"}, time.Hour)
+	dir, _ := ioutil.TempDir("", "feednotifier")
+	defer os.RemoveAll(dir)
+	value := FeedUrl{url: "https://example.com/rss", basedir: dir, savePath: filepath.Join(dir, "feed")}
+	recordSeen([]*FeedItem{{Item: datedItem("1h", 0)}}, value)
+
+	items := []*gofeed.Item{datedItem("1h", time.Hour), datedItem("2h", 2*time.Hour), datedItem("3h", 3*time.Hour)}
+	pushItems(value.url, value, &gofeed.Feed{}, items, nil, 2, nil)
+	var titles []string
+	for _, sent := range loadSentItems(value.savePath) {
+		titles = append(titles, sent.Item.Title)
+	}
+	if len(titles) != 2 || titles[0] == "1h" || titles[1] == "1h" {
+		t.Errorf("expected duplicates not to count against the limit, got %v", titles)
+	}
+}
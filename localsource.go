@@ -0,0 +1,171 @@
+package feednotifier
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/mmcdole/gofeed"
+	log "github.com/sirupsen/logrus"
+)
+
+// Local sources read from the file system instead of over http:
+//
+//	file:///var/lib/reports/feed.xml     an rss, atom or json feed document
+//	dir:///srv/incoming pattern=*.pdf    every file in the folder is an item
+//
+// Folders of dir:// feeds are watched, so new files are sent right away
+// rather than on the next scheduled run.
+
+// localPath returns the path in a file:// or dir:// url; file://./x and
+// file://x are relative to the working directory
+func localPath(line string) (string, error) {
+	u, err := url.Parse(line)
+	if err != nil {
+		return "", err
+	}
+	path := u.Path
+	if u.Host != "" && u.Host != "localhost" {
+		path = u.Host + path
+	}
+	if path == "" {
+		return "", fmt.Errorf("%s has no path", line)
+	}
+	return filepath.FromSlash(path), nil
+}
+
+func fileSource(value FeedUrl) ([]byte, error) {
+	path, err := localPath(value.url)
+	if err != nil {
+		return nil, err
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// parsed here so a half written file doesn't replace the base file
+	if _, err := ParseFeed(bytes.NewReader(content)); err != nil {
+		return nil, fmt.Errorf("could not parse %s, %v", path, err)
+	}
+	return content, nil
+}
+
+// dirSource lists the files in a folder, optionally matching pattern=GLOB,
+// as items; hidden files and sub folders are skipped. A file that is
+// replaced keeps its id and gets a new updated date.
+func dirSource(value FeedUrl) (*gofeed.Feed, error) {
+	dir, err := localPath(value.url)
+	if err != nil {
+		return nil, err
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	pattern := value.opts["pattern"]
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern=%s for %s, %v", pattern, value.url, err)
+	}
+	feed := &gofeed.Feed{Title: filepath.Base(dir), Link: value.url}
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || strings.HasPrefix(name, ".") {
+			continue
+		}
+		if matched, _ := filepath.Match(pattern, name); pattern != "" && !matched {
+			continue
+		}
+		path, _ := filepath.Abs(filepath.Join(dir, name))
+		link := (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+		modified := info.ModTime().UTC()
+		feed.Items = append(feed.Items, &gofeed.Item{
+			GUID:            path,
+			Title:           name,
+			Link:            link,
+			Published:       modified.Format(time.RFC3339),
+			PublishedParsed: &modified,
+			Updated:         modified.Format(time.RFC3339),
+			UpdatedParsed:   &modified,
+			Enclosures: []*gofeed.Enclosure{{
+				URL:    link,
+				Type:   mime.TypeByExtension(filepath.Ext(name)),
+				Length: strconv.FormatInt(info.Size(), 10),
+			}},
+		})
+	}
+	return feed, nil
+}
+
+// watchDirs watches the folders of dir:// feeds and stops watching those of
+// removed feeds; the caller holds mf.lock
+func (mf *MonitoredFile) watchDirs() {
+	if mf.dirWatchers == nil {
+		mf.dirWatchers = make(map[string]*fsnotify.Watcher)
+	}
+	for feedURL, watcher := range mf.dirWatchers {
+		if _, ok := mf.urls[feedURL]; !ok {
+			log.Debugf("Stopped watching folder of %s", feedURL)
+			watcher.Close()
+			delete(mf.dirWatchers, feedURL)
+		}
+	}
+	for feedURL, value := range mf.urls {
+		if _, ok := mf.dirWatchers[feedURL]; ok || sourceType(feedURL, value) != "dir" {
+			continue
+		}
+		dir, err := localPath(feedURL)
+		if err != nil {
+			continue
+		}
+		watcher, err := fsnotify.NewWatcher()
+		if err == nil {
+			err = watcher.Add(dir)
+		}
+		if err != nil {
+			log.Warnf("Could not watch folder %s of %s - new files are found on scheduled runs, %v", dir, feedURL, err)
+			if watcher != nil {
+				watcher.Close()
+			}
+			continue
+		}
+		log.Debugf("Watching folder %s of %s", dir, feedURL)
+		mf.dirWatchers[feedURL] = watcher
+		go mf.checkOnChange(feedURL, watcher)
+	}
+}
+
+// dirDebounce is how long a folder must be quiet before it is checked, so
+// a file being copied in is read once it is complete
+var dirDebounce = 2 * time.Second
+
+func (mf *MonitoredFile) checkOnChange(feedURL string, watcher *fsnotify.Watcher) {
+	var timer *time.Timer
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op&(fsnotify.Create|fsnotify.Write|fsnotify.Rename) == 0 {
+				continue
+			}
+			log.Debugf("Folder of %s changed: %v", feedURL, event)
+			if timer != nil {
+				timer.Stop()
+			}
+			timer = time.AfterFunc(dirDebounce, func() { mf.CheckNow(feedURL) })
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Debugf("Error watching folder of %s, %v", feedURL, err)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package feednotifier
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer safe for notifiers running in the background
+type syncBuffer struct {
+	sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.Lock()
+	defer b.Unlock()
+	return b.buf.String()
+}
+
+func TestLocalPath(t *testing.T) {
+	tests := map[string]string{
+		"file:///var/feeds/a.xml":          "/var/feeds/a.xml",
+		"file://localhost/var/feeds/a.xml": "/var/feeds/a.xml",
+		"file://./feeds/a.xml":             "./feeds/a.xml",
+		"dir://incoming":                   "incoming",
+	}
+	for line, want := range tests {
+		if got, err := localPath(line); err != nil || got != filepath.FromSlash(want) {
+			t.Errorf("%s: expected %s, got %s %v", line, want, got, err)
+		}
+	}
+	if _, err := localPath("file://"); err == nil {
+		t.Errorf("expected an error for a url without path")
+	}
+}
+
+func TestProcessLineFile(t *testing.T) {
+	initTemplates()
+	dir, _ := ioutil.TempDir("", "feednotifier")
+	defer os.RemoveAll(dir)
+	feedFile := filepath.Join(dir, "feed.xml")
+	copyFile("test/zooqle.first.xml", feedFile)
+
+	out := &bytes.Buffer{}
+	notifiers := []Notifier{NewDryRunNotifier(newPushover("abc", "def"), out)}
+	line := "file://" + filepath.ToSlash(feedFile)
+	value := FeedUrl{url: line, savePath: SavePath(dir, line), basedir: dir}
+	processLine(line, value, notifiers)
+	if !strings.Contains(out.String(), "New url") {
+		t.Fatalf("expected acknowledgement message, got %s", out.String())
+	}
+	copyFile("test/zooqle.second.xml", feedFile)
+	out.Reset()
+	processLine(line, value, notifiers)
+	if !strings.Contains(out.String(), "template: __message") {
+		t.Errorf("expected new items from the local file, got %s", out.String())
+	}
+
+	ioutil.WriteFile(feedFile, []byte("<rss"), 0644)
+	if _, err := fileSource(value); err == nil {
+		t.Errorf("expected a broken file to fail")
+	}
+}
+
+func TestDirSource(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "feednotifier")
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"report.pdf", "notes.txt", ".partial.pdf"} {
+		ioutil.WriteFile(filepath.Join(dir, name), []byte("content"), 0644)
+	}
+	os.Mkdir(filepath.Join(dir, "archive.pdf"), os.ModePerm)
+
+	feed, err := dirSource(FeedUrl{url: "dir://" + filepath.ToSlash(dir), opts: map[string]string{"pattern": "*.pdf"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feed.Items) != 1 {
+		t.Fatalf("expected only report.pdf, got %d items", len(feed.Items))
+	}
+	item := feed.Items[0]
+	if item.Title != "report.pdf" || !strings.HasPrefix(item.Link, "file:///") || item.Enclosures[0].Type != "application/pdf" ||
+		item.Enclosures[0].Length != "7" || item.UpdatedParsed == nil {
+		t.Errorf("unexpected item %+v", item)
+	}
+	if _, err := dirSource(FeedUrl{url: "dir://" + filepath.ToSlash(dir), opts: map[string]string{"pattern": "["}}); err == nil {
+		t.Errorf("expected an invalid pattern to fail")
+	}
+}
+
+func TestDirWatch(t *testing.T) {
+	initTemplates()
+	dir, _ := ioutil.TempDir("", "feednotifier")
+	defer os.RemoveAll(dir)
+	incoming := filepath.Join(dir, "incoming")
+	os.Mkdir(incoming, os.ModePerm)
+	ioutil.WriteFile(filepath.Join(incoming, "first.txt"), []byte("1"), 0644)
+	watchFile := filepath.Join(dir, "watch.txt")
+	line := "dir://" + filepath.ToSlash(incoming)
+	ioutil.WriteFile(watchFile, []byte(line+"\n"), 0644)
+	defer func(d time.Duration) { dirDebounce = d }(dirDebounce)
+	dirDebounce = 50 * time.Millisecond
+
+	out := &syncBuffer{}
+	notifiers := []Notifier{NewDryRunNotifier(newPushover("abc", "def"), out)}
+	mf := &MonitoredFile{filename: watchFile, urls: make(map[string]FeedUrl), interval: 30, notifiers: &notifiers, basedir: dir}
+	if err := mf.initFile(); err != nil {
+		t.Fatal(err)
+	}
+	if len(mf.dirWatchers) != 1 {
+		t.Fatalf("expected the folder to be watched")
+	}
+	ioutil.WriteFile(filepath.Join(incoming, "second.txt"), []byte("2"), 0644)
+	for i := 0; i < 100 && !strings.Contains(out.String(), "second.txt"); i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if !strings.Contains(out.String(), "second.txt") || strings.Contains(out.String(), "first.txt") {
+		t.Errorf("expected only the new file to be sent, got %s", out.String())
+	}
+
+	ioutil.WriteFile(watchFile, nil, 0644)
+	mf.initFile()
+	if len(mf.dirWatchers) != 0 {
+		t.Errorf("expected the folder of the removed feed to no longer be watched")
+	}
+	mf.runLock.Lock()
+	mf.runLock.Unlock()
+}
+
+func TestCheckRemoteFeed(t *testing.T) {
+	defer SetAllowLocalFeeds(false)
+	for _, spec := range []FeedSpec{{URL: "file:///etc/passwd"}, {URL: "dir:///"}, {URL: "exec:/bin/sh"}} {
+		if err := checkRemoteFeed(spec); err == nil {
+			t.Errorf("expected %s to be refused", spec.URL)
+		}
+	}
+	if err := checkRemoteFeed(FeedSpec{URL: "https://example.org/rss"}); err != nil {
+		t.Errorf("expected http feeds to be allowed, got %v", err)
+	}
+	SetAllowLocalFeeds(true)
+	if err := checkRemoteFeed(FeedSpec{URL: "file:///var/lib/reports/feed.xml"}); err != nil {
+		t.Errorf("expected local feeds to be allowed, got %v", err)
+	}
+}
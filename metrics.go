@@ -0,0 +1,92 @@
+package feednotifier
+
+import (
+	"crypto/md5"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// diff engines reported by the diffs metric
+const (
+	engineXSLT           = "xslt"
+	engineInProc         = "inproc"
+	engineInProcFallback = "inproc_fallback"
+)
+
+var (
+	fetchesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "feednotifier_fetches_total",
+		Help: "Feed fetches by feed and http status code; code is \"error\" when no response was received.",
+	}, []string{"feed", "code"})
+	fetchBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "feednotifier_fetch_bytes_total",
+		Help: "Bytes downloaded per feed.",
+	}, []string{"feed"})
+	fetchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "feednotifier_fetch_duration_seconds",
+		Help:    "Time taken to get a response for a feed.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"feed"})
+	notModifiedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "feednotifier_not_modified_total",
+		Help: "Fetches answered with 304 Not Modified per feed.",
+	}, []string{"feed"})
+	rateLimitedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "feednotifier_rate_limited_total",
+		Help: "Fetches answered with 429 Too Many Requests per feed.",
+	}, []string{"feed"})
+	diffsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "feednotifier_diffs_total",
+		Help: "Feed comparisons by diff engine: xslt, inproc or inproc_fallback after an xslt failure.",
+	}, []string{"engine"})
+	newItemsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "feednotifier_new_items_total",
+		Help: "New items found per feed, before filters.",
+	}, []string{"feed"})
+	notificationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "feednotifier_notifications_total",
+		Help: "Item notifications per notifier type and result: sent or failed.",
+	}, []string{"notifier", "result"})
+	watchFileReloadsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "feednotifier_watch_file_reloads_total",
+		Help: "Watch file reloads after a change, by file and result: ok or error.",
+	}, []string{"file", "result"})
+)
+
+// feedLabel is the feed label of a url. Credentials and the query, which may
+// hold tokens, are left out; a hash of the query keeps feeds apart that only
+// differ in it.
+func feedLabel(line string) string {
+	u, err := url.Parse(line)
+	if err != nil {
+		return "invalid"
+	}
+	label := (&url.URL{Scheme: u.Scheme, Opaque: u.Opaque, Host: u.Host, Path: u.Path}).String()
+	if u.RawQuery != "" {
+		label += fmt.Sprintf("?%x", md5.Sum([]byte(u.RawQuery)))[:9]
+	}
+	return label
+}
+
+func observeFetch(line string, code int, start time.Time) {
+	label := "error"
+	if code != 0 {
+		label = strconv.Itoa(code)
+	}
+	fetchesTotal.WithLabelValues(feedLabel(line), label).Inc()
+	fetchDuration.WithLabelValues(feedLabel(line)).Observe(time.Since(start).Seconds())
+}
+
+func observeNotification(notifier Notifier, err error) {
+	kind, _ := describeNotifier(notifier)
+	result := "sent"
+	if err != nil {
+		result = "failed"
+	}
+	notificationsTotal.WithLabelValues(kind, result).Inc()
+}
@@ -3,14 +3,16 @@ package feednotifier
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strings"
 	"text/template"
+	"time"
 
-	"github.com/mmcdole/gofeed"
 	"github.com/raghur/feednotifier/static"
 	log "github.com/sirupsen/logrus"
 )
@@ -24,44 +26,87 @@ func initTemplates() {
 	if didInitTemplates {
 		return
 	}
-	defaultTmpl, _ := template.New(defaultTemplate).Parse(`
+	defaultTmpl, _ := template.New(defaultTemplate).Funcs(templateFuncs).Parse(`
 		Message: [{{.Title}}]({{.Link}})
 		`)
 	text, _ := static.ReadFile("assets/default.tmpl")
 	s := string(text)
-	mdTmpl, _ = template.New("embedded").Parse(s)
+	mdTmpl, _ = template.New("embedded").Funcs(templateFuncs).Parse(s)
 	mdTmpl.AddParseTree(defaultTemplate, defaultTmpl.Tree)
+	updateTmpl, _ := template.New(updateTemplate).Funcs(templateFuncs).Parse(`
+		Updated: [{{.Title}}]({{.Link}})
+		{{with .TitleDiff}}{{.}}
+		{{end}}{{.DescriptionDiff}}
+		`)
+	mdTmpl.AddParseTree(updateTemplate, updateTmpl.Tree)
 	log.Debugf("Default templates loaded are: %s", mdTmpl.DefinedTemplates())
 	didInitTemplates = true
 }
 
-func ParseCustomTemplates(templates []string) {
+// ParseCustomTemplates loads template files on top of the embedded templates.
+// Templates are looked up by feed hostname, so a file can override the
+// embedded templates as well as the default by defining a template of the
+// same name.
+func ParseCustomTemplates(templates []string) error {
 	initTemplates()
 	if len(templates) > 0 {
 		log.Debugf("Parsing custom templates, %v", templates)
-		custom, err := template.ParseFiles(templates...)
+		custom, _ := mdTmpl.Clone()
+		custom, err := custom.ParseFiles(templates...)
 		if err != nil {
 			log.Warnf("Error loading templates from files - %v", err)
 			log.Warnf("Will use default template for all notifications")
-			return
+			return err
 		}
 
-		mdTmpl, _ = custom.AddParseTree(defaultTemplate, mdTmpl.Tree)
+		mdTmpl = custom
 		log.Info(mdTmpl.DefinedTemplates())
-		return
 	}
+	return nil
 }
 
 /* Notifier ...
  */
 type Notifier interface {
-	NotifyItem(furl string, item *gofeed.Item)
-	Notify(msg string)
+	NotifyItem(item *FeedItem) error
+	Notify(msg string) error
+	// Validate checks the notifier's credentials against its service
+	Validate() error
+}
+
+// api endpoints; overridden in tests
+var pushoverAPI = "https://api.pushover.net/1"
+var telegramAPI = "https://api.telegram.org"
+
+// notifierClient limits calls to notifier services so a hung service doesn't
+// hold up the remaining items. It allows longer than the telegram bot's long
+// poll.
+var notifierClient = &http.Client{Timeout: time.Minute}
+
+// postForm posts data to endpoint and returns the response body; non 2xx
+// responses are returned as errors
+func postForm(endpoint string, data url.Values) ([]byte, error) {
+	return postFormClient(notifierClient, endpoint, data)
+}
+
+// postFormClient is postForm with the given client
+func postFormClient(client *http.Client, endpoint string, data url.Values) ([]byte, error) {
+	resp, err := client.PostForm(endpoint, data)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	responseContent, _ := ioutil.ReadAll(bufio.NewReader(resp.Body))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return responseContent, fmt.Errorf("%s - %s", resp.Status, responseContent)
+	}
+	return responseContent, nil
 }
 
 type pushover struct {
-	token string
-	user  string
+	token  string
+	user   string
+	format outputFormat
 }
 
 func newPushover(token, user string) *pushover {
@@ -74,43 +119,60 @@ func (p pushover) String() string {
 	return fmt.Sprintf("[PUSHOVER: %s]", p.user)
 }
 
-func (p *pushover) Notify(msg string) {
-	data := make(url.Values)
+func (p *pushover) send(data url.Values) ([]byte, error) {
 	data["token"] = []string{p.token}
 	data["user"] = []string{p.user}
+	if p.format == formatHTML {
+		data["html"] = []string{"1"}
+	}
+	return postForm(pushoverAPI+"/messages.json", data)
+}
+
+func (p *pushover) Notify(msg string) error {
+	data := make(url.Values)
 	data["title"] = []string{"Feednotifier - message"}
-	data["message"] = []string{msg}
+	data["message"] = []string{escapeMessage(p.format, msg)}
 
-	resp, err := http.PostForm("https://api.pushover.net/1/messages.json", data)
+	responseContent, err := p.send(data)
 	if err != nil {
 		log.Errorf("Error sending push notification %v", err)
+		return err
 	}
-	defer resp.Body.Close()
-	responseContent, _ := ioutil.ReadAll(bufio.NewReader(resp.Body))
 	log.Debugf("Pushed %s - response: %s", msg, responseContent)
+	return nil
 }
-func (p *pushover) NotifyItem(furl string, item *gofeed.Item) {
+func (p *pushover) NotifyItem(item *FeedItem) error {
 
 	data := make(url.Values)
-	data["token"] = []string{p.token}
-	data["user"] = []string{p.user}
 	data["title"] = []string{item.Title}
 	data["url"] = []string{item.Link}
 	data["url_title"] = []string{"Add this torrent"}
-	data["message"] = []string{renderItem(furl, item)}
+	data["message"] = []string{renderItem("pushover", p.format, item)}
 
-	resp, err := http.PostForm("https://api.pushover.net/1/messages.json", data)
+	responseContent, err := p.send(data)
 	if err != nil {
 		log.Errorf("Error sending push notification %v", err)
+		return err
 	}
-	defer resp.Body.Close()
-	responseContent, _ := ioutil.ReadAll(bufio.NewReader(resp.Body))
 	log.Debugf("Pushed %s - response: %s", item.Title, responseContent)
+	return nil
+}
+
+func (p *pushover) Validate() error {
+	data := make(url.Values)
+	data["token"] = []string{p.token}
+	data["user"] = []string{p.user}
+	if _, err := postForm(pushoverAPI+"/users/validate.json", data); err != nil {
+		return fmt.Errorf("pushover rejected the token or user key: %v", err)
+	}
+	return nil
 }
 
 type telegramNotifier struct {
-	botId  string
-	chatId string
+	botId   string
+	chatId  string
+	format  outputFormat
+	buttons bool
 }
 
 func (p *telegramNotifier) String() string {
@@ -121,74 +183,258 @@ func newTelegramNotifier(botid, chatid string) *telegramNotifier {
 	var p telegramNotifier
 	p.botId = botid
 	p.chatId = chatid
+	p.format = formatMarkdown
 	return &p
 }
 
-func (p *telegramNotifier) Notify(msg string) {
+func (p *telegramNotifier) method(name string) string {
+	return fmt.Sprintf("%s/bot%s/%s", telegramAPI, p.botId, name)
+}
+
+// post calls a bot api method. Client errors quote the url and with it the
+// bot token, so the token is blanked out before errors are logged or shown
+func (p *telegramNotifier) post(name string, data url.Values) ([]byte, error) {
+	return p.postClient(notifierClient, name, data)
+}
+
+// postClient is post with the given client
+func (p *telegramNotifier) postClient(client *http.Client, name string, data url.Values) ([]byte, error) {
+	responseContent, err := postFormClient(client, p.method(name), data)
+	if err != nil && p.botId != "" && strings.Contains(err.Error(), p.botId) {
+		err = errors.New(strings.Replace(err.Error(), p.botId, "<token>", -1))
+	}
+	return responseContent, err
+}
+
+func (p *telegramNotifier) parseMode() string {
+	switch p.format {
+	case formatMarkdownV2:
+		return "MarkdownV2"
+	case formatHTML:
+		return "HTML"
+	}
+	return "markdown"
+}
+
+// send posts a message to the chat with an optional reply markup. If
+// telegram cannot parse the message the message is sent again as plain text
+// so that it is not lost.
+func (p *telegramNotifier) send(text, replyMarkup string) ([]byte, error) {
 	data := make(url.Values)
 	data["chat_id"] = []string{p.chatId}
-	data["text"] = []string{msg}
-	data["parse_mode"] = []string{"markdown"}
+	data["text"] = []string{text}
+	data["parse_mode"] = []string{p.parseMode()}
+	if replyMarkup != "" {
+		data["reply_markup"] = []string{replyMarkup}
+	}
+	responseContent, err := p.post("sendMessage", data)
+	if err != nil && strings.Contains(string(responseContent), "can't parse entities") {
+		log.Warnf("Telegram could not parse %s message, resending as plain text - %v", p.format, err)
+		delete(data, "parse_mode")
+		return p.post("sendMessage", data)
+	}
+	return responseContent, err
+}
 
-	url := strings.Replace("https://api.telegram.org/bot{}/sendMessage", "{}", p.botId, -1)
-	resp, err := http.PostForm(url, data)
+func (p *telegramNotifier) Notify(msg string) error {
+	responseContent, err := p.send(escapeMessage(p.format, msg), "")
 	if err != nil {
 		log.Errorf("Error sending push notification %v", err)
+		return err
 	}
-	defer resp.Body.Close()
-	responseContent, _ := ioutil.ReadAll(bufio.NewReader(resp.Body))
 	log.Debugf("Pushed %s - response: %s", msg, responseContent)
+	return nil
 }
 
-func (p *telegramNotifier) NotifyItem(furl string, item *gofeed.Item) {
-
-	data := make(url.Values)
-	data["chat_id"] = []string{p.chatId}
-	renderItem(furl, item)
-	data["text"] = []string{renderItem(furl, item)}
-	data["parse_mode"] = []string{"markdown"}
-	//log.Debugf("Item:  %v", item)
-	url := strings.Replace("https://api.telegram.org/bot{}/sendMessage", "{}", p.botId, -1)
-	resp, err := http.PostForm(url, data)
+func (p *telegramNotifier) NotifyItem(item *FeedItem) error {
+	markup := ""
+	if p.buttons {
+		markup = itemKeyboard(item)
+	}
+	responseContent, err := p.send(renderItem("telegram", p.format, item), markup)
 	if err != nil {
 		log.Errorf("Error sending push notification %v", err)
+		return err
 	}
-	defer resp.Body.Close()
-	responseContent, _ := ioutil.ReadAll(bufio.NewReader(resp.Body))
 	log.Debugf("Pushed feed item- response: %s", responseContent)
+	return nil
+}
 
+func (p *telegramNotifier) Validate() error {
+	if _, err := p.post("getMe", nil); err != nil {
+		return fmt.Errorf("telegram rejected the bot token: %v", err)
+	}
+	data := make(url.Values)
+	data["chat_id"] = []string{p.chatId}
+	if _, err := p.post("getChat", data); err != nil {
+		return fmt.Errorf("telegram bot cannot access chat %s: %v", p.chatId, err)
+	}
+	return nil
 }
 
-func renderItem(furl string, item *gofeed.Item) string {
-	u, _ := url.Parse(furl)
-	templateName := u.Hostname()
-	if t := mdTmpl.Lookup(templateName); t == nil {
-		templateName = defaultTemplate
+// templateFor returns the name of the template used to render an item for a
+// notifier type. The most specific of <type>/<hostname>, <hostname>,
+// <type>/default, default and the built in default is used; updated items
+// use <type>/update, update or the built in update template.
+func templateFor(notifierType string, item *FeedItem) string {
+	u, _ := url.Parse(item.FeedURL)
+	candidates := []string{u.Hostname(), "default"}
+	if notifierType != "" {
+		candidates = []string{notifierType + "/" + u.Hostname(), u.Hostname(), notifierType + "/default", "default"}
 	}
+	fallback := defaultTemplate
+	if item.IsUpdate() {
+		candidates = []string{"update"}
+		if notifierType != "" {
+			candidates = []string{notifierType + "/update", "update"}
+		}
+		fallback = updateTemplate
+	}
+	for _, name := range candidates {
+		if mdTmpl.Lookup(name) != nil {
+			return name
+		}
+	}
+	return fallback
+}
+
+// templateData is what item templates are executed with
+type templateData struct {
+	*FeedItem
+	Notifier string
+}
+
+func executeTemplate(name string, format outputFormat, data *templateData) (string, error) {
+	t, err := mdTmpl.Clone()
+	if err != nil {
+		return "", err
+	}
+	if err = escapeTemplates(t, format); err != nil {
+		return "", err
+	}
+	t.Funcs(template.FuncMap{"ext": data.Ext})
 	buf := bytes.NewBufferString("")
-	err := mdTmpl.ExecuteTemplate(buf, templateName, item)
+	err = t.ExecuteTemplate(buf, name, data)
+	return buf.String(), err
+}
+
+// RenderItem renders item for the given notifier type and format (markdown,
+// markdownv2, html or "" for plain text) with the template selected for its
+// feed. Unlike the notifiers it does not fall back to the default template,
+// so template errors are returned as is.
+func RenderItem(notifierType, format string, item *FeedItem) (templateName, text string, err error) {
+	initTemplates()
+	templateName = templateFor(notifierType, item)
+	f, err := parseOutputFormat(format)
 	if err != nil {
-		mdTmpl.ExecuteTemplate(buf, defaultTemplate, item)
-		return fmt.Sprintf("There was an error rendering message content - %v. Message is rendered with default template below: \n%s", err, buf.String())
+		return templateName, "", err
 	}
-	return buf.String()
+	text, err = executeTemplate(templateName, f, &templateData{item, notifierType})
+	return templateName, text, err
 }
 
+func renderItem(notifierType string, format outputFormat, item *FeedItem) string {
+	templateName, text, err := RenderItem(notifierType, string(format), item)
+	if err != nil {
+		log.Warnf("Error rendering template %s, %v", templateName, err)
+		text, _ = executeTemplate(defaultTemplate, format, &templateData{item, notifierType})
+		return fmt.Sprintf("%s\n%s", escapeMessage(format, fmt.Sprintf("There was an error rendering message content - %v. Message is rendered with default template below: ", err)), text)
+	}
+	return text
+}
+
+// describeNotifier returns the name used in notifier specs, which is exposed
+// to templates, and the format the notifier sends messages in
+func describeNotifier(n Notifier) (string, outputFormat) {
+	switch p := n.(type) {
+	case *telegramNotifier:
+		return "telegram", p.format
+	case *pushover:
+		return "pushover", p.format
+	case *feedOutput:
+		return "feed", formatHTML
+	case *dryRunNotifier:
+		return describeNotifier(p.notifier)
+	}
+	return "", formatText
+}
+
+// dryRunNotifier prints what the wrapped notifier would have sent instead of sending it
+type dryRunNotifier struct {
+	notifier Notifier
+	out      io.Writer
+}
+
+// NewDryRunNotifier wraps n so that messages and items are rendered to out
+func NewDryRunNotifier(n Notifier, out io.Writer) Notifier {
+	return &dryRunNotifier{notifier: n, out: out}
+}
+
+func (p *dryRunNotifier) String() string {
+	return fmt.Sprintf("[DRYRUN]%v", p.notifier)
+}
+
+func (p *dryRunNotifier) Notify(msg string) error {
+	_, err := fmt.Fprintf(p.out, "---- %v message ----\n%s\n", p.notifier, msg)
+	return err
+}
+
+func (p *dryRunNotifier) NotifyItem(item *FeedItem) error {
+	kind, format := describeNotifier(p.notifier)
+	_, err := fmt.Fprintf(p.out, "---- %v item from %s (template: %s, format: %s) ----\n%s\n",
+		p.notifier, item.FeedURL, templateFor(kind, item), format, renderItem(kind, format, item))
+	return err
+}
+
+func (p *dryRunNotifier) Validate() error {
+	return p.notifier.Validate()
+}
+
+// CreateNotifier parses a notifier spec:
+//
+//	telegram:<bot token>#<chat id>[#markdown|markdownv2|html][#buttons]
+//	pushover:<app token>:<user key>[:html]
+//	feed:[<folder>][#file|#tag][#<items to keep>]
 func CreateNotifier(spec string) (Notifier, error) {
 	initTemplates() // in case parse custom templates was never called? stinks.
 	parts := strings.SplitN(spec, ":", 2)
-	if parts == nil {
-		return nil, fmt.Errorf("Error parsing notifier spec - %s", spec)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, fmt.Errorf("Error parsing notifier spec - %s: expected type:value", spec)
 	}
 	switch parts[0] {
 	case "telegram":
 		tokenArr := strings.Split(parts[1], "#")
+		if len(tokenArr) < 2 || tokenArr[0] == "" || tokenArr[1] == "" {
+			return nil, fmt.Errorf("Error parsing telegram notifier spec - expected telegram:<bot token>#<chat id>[#format][#buttons]")
+		}
 		tele := newTelegramNotifier(tokenArr[0], tokenArr[1])
+		for _, option := range tokenArr[2:] {
+			if option == "buttons" {
+				tele.buttons = true
+				continue
+			}
+			format, err := parseOutputFormat(option)
+			if err != nil || format == formatText {
+				return nil, fmt.Errorf("Error parsing telegram notifier spec - options are buttons and a format of markdown, markdownv2 or html")
+			}
+			tele.format = format
+		}
 		return tele, nil
 	case "pushover":
 		tokenArr := strings.Split(parts[1], ":")
+		if len(tokenArr) < 2 || len(tokenArr) > 3 || tokenArr[0] == "" || tokenArr[1] == "" {
+			return nil, fmt.Errorf("Error parsing pushover notifier spec - expected pushover:<app token>:<user key>[:html]")
+		}
 		po := newPushover(tokenArr[0], tokenArr[1])
+		if len(tokenArr) == 3 {
+			if tokenArr[2] != "html" {
+				return nil, fmt.Errorf("Error parsing pushover notifier spec - the only supported format is html")
+			}
+			po.format = formatHTML
+		}
 		return po, nil
+	case "feed":
+		return parseFeedOutput(parts[1])
 	}
-	return nil, fmt.Errorf("Unknown spec format - %s", spec)
+	return nil, fmt.Errorf("Unknown notifier type - %s", parts[0])
 }
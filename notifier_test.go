@@ -0,0 +1,147 @@
+package feednotifier
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func TestRenderItemCustomTemplates(t *testing.T) {
+	initTemplates()
+	saved := mdTmpl
+	defer func() { mdTmpl = saved }()
+
+	if err := ParseCustomTemplates([]string{"test/templates/custom.tmpl"}); err != nil {
+		t.Fatal(err)
+	}
+	item := &FeedItem{Item: &gofeed.Item{Title: "Some title", Link: "https://example.com/item"}}
+
+	name, text, err := RenderItem("", "", withURL(item, "https://zooqle.com/rss"))
+	if name != "zooqle.com" || text != "*Some title*" || err != nil {
+		t.Errorf("unexpected custom render: %s, %q, %v", name, text, err)
+	}
+	name, text, err = RenderItem("", "", withURL(item, "https://unknown.org/rss"))
+	if name != defaultTemplate || !strings.Contains(text, "[Some title](https://example.com/item)") || err != nil {
+		t.Errorf("default template should survive custom templates: %s, %q, %v", name, text, err)
+	}
+	name, _, err = RenderItem("", "", withURL(item, "https://www.reddit.com/r/golang/.rss"))
+	if name != "www.reddit.com" {
+		t.Errorf("embedded templates should survive custom templates, got %s", name)
+	}
+	_, _, err = RenderItem("", "", withURL(item, "https://broken.com/rss"))
+	if err == nil || !strings.Contains(err.Error(), "custom.tmpl:3") {
+		t.Errorf("expected error with line number, got %v", err)
+	}
+}
+
+func TestParseCustomTemplatesError(t *testing.T) {
+	initTemplates()
+	saved := mdTmpl
+	defer func() { mdTmpl = saved }()
+	if err := ParseCustomTemplates([]string{"test/templates/doesnotexist.tmpl"}); err == nil {
+		t.Errorf("expected error loading missing template")
+	}
+	if mdTmpl != saved {
+		t.Errorf("templates should be unchanged after a failed load")
+	}
+}
+
+func withURL(item *FeedItem, furl string) *FeedItem {
+	copy := *item
+	copy.FeedURL = furl
+	return &copy
+}
+
+func TestRenderItemPerNotifierEscaping(t *testing.T) {
+	initTemplates()
+	saved := mdTmpl
+	defer func() { mdTmpl = saved }()
+	if err := ParseCustomTemplates([]string{"test/templates/notifiers.tmpl"}); err != nil {
+		t.Fatal(err)
+	}
+	item := &FeedItem{Item: &gofeed.Item{Title: "a_b.c <i>", Link: "https://example.com/x_y"}, FeedURL: "https://example.com/rss"}
+
+	name, text, _ := RenderItem("telegram", "markdownv2", item)
+	if name != "telegram/default" || text != `*a\_b\.c <i\>* [link](https://example\.com/x\_y)` {
+		t.Errorf("unexpected markdownv2 render: %s, %q", name, text)
+	}
+	name, text, _ = RenderItem("pushover", "html", item)
+	if name != "pushover/example.com" || text != "<b>a_b.c &lt;i&gt;</b> a_b.c <i>" {
+		t.Errorf("unexpected html render: %s, %q", name, text)
+	}
+	// legacy markdown has no escapes in link targets
+	_, text, _ = RenderItem("telegram", "markdown", item)
+	if text != `*a\_b.c <i>* [link](https://example.com/x_y)` {
+		t.Errorf("unexpected markdown render: %q", text)
+	}
+	// templates must not be modified by escaping
+	_, text, _ = RenderItem("telegram", "", item)
+	if text != "*a_b.c <i>* [link](https://example.com/x_y)" {
+		t.Errorf("unexpected plain render: %q", text)
+	}
+}
+
+func TestTelegramResendsUnparseableMessages(t *testing.T) {
+	var modes []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		modes = append(modes, r.Form.Get("parse_mode"))
+		if r.Form.Get("parse_mode") != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"ok":false,"description":"Bad Request: can't parse entities"}`)
+			return
+		}
+		fmt.Fprint(w, `{"ok":true}`)
+	}))
+	defer ts.Close()
+	defer func(tg string) { telegramAPI = tg }(telegramAPI)
+	telegramAPI = ts.URL
+
+	n, _ := CreateNotifier("telegram:bot#42#markdownv2")
+	if err := n.Notify("unbalanced *"); err != nil {
+		t.Errorf("expected plain text resend to succeed, got %v", err)
+	}
+	if len(modes) != 2 || modes[0] != "MarkdownV2" || modes[1] != "" {
+		t.Errorf("unexpected requests %v", modes)
+	}
+}
+
+func TestTelegramErrorsHideToken(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.Close()
+	defer func(tg string) { telegramAPI = tg }(telegramAPI)
+	telegramAPI = ts.URL
+
+	n, _ := CreateNotifier("telegram:123:secret#42")
+	err := n.Validate()
+	if err == nil || strings.Contains(err.Error(), "123:secret") {
+		t.Errorf("expected an error without the token, got %v", err)
+	}
+}
+
+func TestNotifierTimeout(t *testing.T) {
+	done := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer ts.Close()
+	defer close(done)
+	defer func(api string, client *http.Client) { pushoverAPI, notifierClient = api, client }(pushoverAPI, notifierClient)
+	pushoverAPI, notifierClient = ts.URL, &http.Client{Timeout: 100 * time.Millisecond}
+
+	start := time.Now()
+	if err := newPushover("abc", "def").Notify("hello"); err == nil {
+		t.Fatal("expected a timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the notification to stop after the timeout, took %v", elapsed)
+	}
+}
@@ -1,6 +1,9 @@
 package feednotifier
 
 import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
 
@@ -20,5 +23,45 @@ func TestSendPush(t *testing.T) {
 		t.Errorf("Unexpected error parsing token - %s", pushoverToken)
 		t.Fail()
 	}
-	po.NotifyItem("www.somewhere.com/invalid/url", item)
+	po.NotifyItem(&FeedItem{Item: item, FeedURL: "www.somewhere.com/invalid/url"})
+}
+
+func TestCreateNotifierInvalidSpecs(t *testing.T) {
+	for _, spec := range []string{"telegram", "telegram:", "telegram:token", "telegram:#chat", "pushover:token", "pushover::user", "unknown:abc", "telegram:bot#chat#rtf", "pushover:token:user:markdown"} {
+		if _, e := CreateNotifier(spec); e == nil {
+			t.Errorf("Expected error parsing spec - %s", spec)
+		}
+	}
+}
+
+func TestValidateNotifiers(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		switch {
+		case r.URL.Path == "/1/users/validate.json" && r.Form.Get("user") == "gooduser":
+			fmt.Fprint(w, `{"status":1}`)
+		case r.URL.Path == "/botgoodbot/getMe", r.URL.Path == "/botgoodbot/getChat" && r.Form.Get("chat_id") == "42":
+			fmt.Fprint(w, `{"ok":true}`)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"ok":false,"status":0}`)
+		}
+	}))
+	defer ts.Close()
+	defer func(p, tg string) { pushoverAPI, telegramAPI = p, tg }(pushoverAPI, telegramAPI)
+	pushoverAPI, telegramAPI = ts.URL+"/1", ts.URL
+
+	expected := map[string]bool{
+		"pushover:token:gooduser": true,
+		"pushover:token:baduser":  false,
+		"telegram:goodbot#42":     true,
+		"telegram:goodbot#43":     false,
+		"telegram:badbot#42":      false,
+	}
+	for spec, valid := range expected {
+		n, _ := CreateNotifier(spec)
+		if e := n.Validate(); (e == nil) != valid {
+			t.Errorf("Validate %s: expected valid=%v, got %v", spec, valid, e)
+		}
+	}
 }
@@ -0,0 +1,147 @@
+package feednotifier
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/mmcdole/gofeed"
+	log "github.com/sirupsen/logrus"
+)
+
+// scrape feeds build items from an html page with css selectors:
+//
+//	item=SELECTOR         each match is an item; required
+//	title=SELECTOR        defaults to the first link
+//	link=SELECTOR         defaults to the href of the first link
+//	date=SELECTOR         publish date of the item
+//	date-format=LAYOUT    go time layout of the date, e.g. "02 Jan 2006"
+//	description=SELECTOR  description of the item
+//
+// Selectors are relative to the item and take the text of the first match;
+// SELECTOR@attr takes an attribute instead and @attr one of the item itself.
+
+// dateLayouts are tried in order for dates without a date-format
+var dateLayouts = []string{
+	time.RFC3339,
+	time.RFC1123Z,
+	time.RFC1123,
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+	"January 2, 2006",
+	"Jan 2, 2006",
+	"2 January 2006",
+	"02 Jan 2006",
+	"2 Jan 2006",
+	"01/02/2006",
+}
+
+func scrapeSource(value FeedUrl) (*gofeed.Feed, error) {
+	itemSelector := value.opts["item"]
+	if itemSelector == "" {
+		return nil, fmt.Errorf("scrape feed %s needs an item selector", value.url)
+	}
+	r, err := fetch(value.url, value.opts)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	doc, err := goquery.NewDocumentFromReader(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse page %s, %v", value.url, err)
+	}
+	base, _ := url.Parse(value.url)
+	if href, ok := doc.Find("base[href]").First().Attr("href"); ok {
+		if u, err := base.Parse(href); err == nil {
+			base = u
+		}
+	}
+	return scrapeItems(doc, base, value)
+}
+
+func scrapeItems(doc *goquery.Document, base *url.URL, value FeedUrl) (*gofeed.Feed, error) {
+	feed := &gofeed.Feed{
+		Title: collapseSpace(doc.Find("title").First().Text()),
+		Link:  value.url,
+	}
+	titleSelector, linkSelector := value.opts["title"], value.opts["link"]
+	if titleSelector == "" {
+		titleSelector = "a"
+	}
+	if linkSelector == "" {
+		linkSelector = "a@href"
+	}
+	doc.Find(value.opts["item"]).Each(func(_ int, s *goquery.Selection) {
+		item := &gofeed.Item{
+			Title:       selectText(s, titleSelector),
+			Description: selectText(s, value.opts["description"]),
+		}
+		if link := selectText(s, linkSelector); link != "" {
+			if u, err := base.Parse(link); err == nil {
+				link = u.String()
+			}
+			item.Link = link
+		}
+		if date := selectText(s, value.opts["date"]); date != "" {
+			item.Published = date
+			if t, err := parseDate(date, value.opts["date-format"]); err == nil {
+				item.PublishedParsed = &t
+			} else {
+				log.Warnf("Scrape feed %s - %v", value.url, err)
+			}
+		}
+		if item.Title == "" && item.Link == "" {
+			return
+		}
+		feed.Items = append(feed.Items, item)
+	})
+	if len(feed.Items) == 0 {
+		return nil, fmt.Errorf("no items matching %s on %s", value.opts["item"], value.url)
+	}
+	return feed, nil
+}
+
+// selectText returns the collapsed text or attribute selected by spec, ""
+// when spec is empty or matches nothing
+func selectText(s *goquery.Selection, spec string) string {
+	if spec == "" {
+		return ""
+	}
+	selector, attr := spec, ""
+	if i := strings.LastIndex(spec, "@"); i >= 0 {
+		selector, attr = spec[:i], spec[i+1:]
+	}
+	if selector != "" {
+		s = s.Find(selector).First()
+	}
+	if s.Length() == 0 {
+		return ""
+	}
+	if attr != "" {
+		v, _ := s.Attr(attr)
+		return strings.TrimSpace(v)
+	}
+	return collapseSpace(s.Text())
+}
+
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// parseDate parses a date with layout, or with the common layouts when
+// layout is empty
+func parseDate(text, layout string) (time.Time, error) {
+	layouts := dateLayouts
+	if layout != "" {
+		layouts = []string{layout}
+	}
+	for _, l := range layouts {
+		if t, err := time.Parse(l, text); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("could not parse date %q", text)
+}
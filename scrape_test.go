@@ -0,0 +1,70 @@
+package feednotifier
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestScrapeSource(t *testing.T) {
+	current := "test/scrape.first.html"
+	ts := serveFile(&current)
+	defer ts.Close()
+	value := FeedUrl{url: ts.URL, opts: map[string]string{
+		"type":        "scrape",
+		"item":        "div.post",
+		"title":       "h2",
+		"date":        "time@datetime",
+		"description": "p.summary",
+	}}
+	feed, err := scrapeSource(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feed.Title != "Example News" || len(feed.Items) != 2 {
+		t.Fatalf("expected 2 items on Example News, got %q with %d items", feed.Title, len(feed.Items))
+	}
+	item := feed.Items[0]
+	if item.Title != "Second post" || item.Link != "https://news.example.org/posts/2" || item.Description != "More news" ||
+		item.PublishedParsed == nil || item.PublishedParsed.Day() != 2 {
+		t.Errorf("unexpected item %+v", item)
+	}
+	if link := feed.Items[1].Link; link != "https://news.example.org/posts/1" {
+		t.Errorf("expected link relative to the base href, got %s", link)
+	}
+
+	value.opts["date"], value.opts["date-format"] = "time", "January 2, 2006"
+	if feed, _ := scrapeSource(value); feed.Items[1].PublishedParsed == nil || feed.Items[1].PublishedParsed.Day() != 1 {
+		t.Errorf("expected date in the given layout to be parsed")
+	}
+	value.opts["item"] = "article"
+	if _, err := scrapeSource(value); err == nil {
+		t.Errorf("expected an error when no items match")
+	}
+}
+
+func TestProcessLineScrape(t *testing.T) {
+	initTemplates()
+	current := "test/scrape.first.html"
+	ts := serveFile(&current)
+	defer ts.Close()
+	dir, _ := ioutil.TempDir("", "feednotifier")
+	defer os.RemoveAll(dir)
+
+	out := &bytes.Buffer{}
+	notifiers := []Notifier{NewDryRunNotifier(newPushover("abc", "def"), out)}
+	value := FeedUrl{url: ts.URL, savePath: filepath.Join(dir, "base"), basedir: dir, opts: map[string]string{"type": "scrape", "item": ".post"}}
+	processLine(ts.URL, value, notifiers)
+	if feed, err := parseFeedFile(value.savePath); err != nil || len(feed.Items) != 2 {
+		t.Fatalf("expected scraped items in the base file, got %v", err)
+	}
+	current = "test/scrape.second.html"
+	out.Reset()
+	processLine(ts.URL, value, notifiers)
+	if n := strings.Count(out.String(), "template: __message"); n != 1 || !strings.Contains(out.String(), "Third post") {
+		t.Errorf("expected only the new post to be sent, got %s", out.String())
+	}
+}
@@ -0,0 +1,90 @@
+package feednotifier
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	log "github.com/sirupsen/logrus"
+)
+
+// SentItem is an item kept after it was sent so the api can search it and
+// send it again. Sent items are kept apart from the feed state, which is
+// read on every run, and only loaded by the api.
+type SentItem struct {
+	ID        string       `json:"id"`
+	Sent      time.Time    `json:"sent"`
+	FeedTitle string       `json:"feedTitle,omitempty"`
+	FeedLink  string       `json:"feedLink,omitempty"`
+	Item      *gofeed.Item `json:"item"`
+	// Previous is the version sent before of an updated item
+	Previous *gofeed.Item `json:"previous,omitempty"`
+}
+
+// maxSentItems is how many sent items are kept per feed
+const maxSentItems = 100
+
+func sentPath(savePath string) string {
+	return savePath + ".sent"
+}
+
+// loadSentItems reads the items kept for a feed, newest first
+func loadSentItems(savePath string) []SentItem {
+	var items []SentItem
+	content, err := ioutil.ReadFile(sentPath(savePath))
+	if err == nil {
+		if err = json.Unmarshal(content, &items); err != nil {
+			log.Warnf("Ignoring corrupt sent items file %s - %v", sentPath(savePath), err)
+		}
+	}
+	return items
+}
+
+// recordSentItems adds items to the front of the items kept for a feed
+func recordSentItems(savePath string, items []*FeedItem) {
+	if dryRun {
+		return
+	}
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	var sent []SentItem
+	now := time.Now()
+	for i := len(items) - 1; i >= 0; i-- {
+		item := items[i]
+		s := SentItem{
+			ID:       fmt.Sprintf("%x", md5.Sum([]byte(fmt.Sprintf("%s|%s|%s|%d|%d", item.FeedURL, item.Link, item.Title, now.UnixNano(), i))))[:12],
+			Sent:     now,
+			Item:     item.Item,
+			Previous: item.Previous,
+		}
+		if item.Feed != nil {
+			s.FeedTitle, s.FeedLink = item.Feed.Title, item.Feed.Link
+		}
+		sent = append(sent, s)
+	}
+	sent = append(sent, loadSentItems(savePath)...)
+	if len(sent) > maxSentItems {
+		sent = sent[:maxSentItems]
+	}
+	content, _ := json.Marshal(sent)
+	os.MkdirAll(filepath.Dir(savePath), os.ModePerm)
+	if err := ioutil.WriteFile(sentPath(savePath), content, 0644); err != nil {
+		log.Errorf("Unable to save sent items to %s, %v", sentPath(savePath), err)
+	}
+}
+
+// feedItem rebuilds the item as it was sent, with the feed it came from
+func (s SentItem) feedItem(value FeedUrl) *FeedItem {
+	feed := &gofeed.Feed{Title: s.FeedTitle, Link: s.FeedLink}
+	if feed.Link == "" {
+		feed.Link = value.url
+	}
+	item := newFeedItem(feed, s.Item, value)
+	item.Previous = s.Previous
+	return item
+}
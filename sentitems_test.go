@@ -0,0 +1,40 @@
+package feednotifier
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"text/template"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func TestSentItemsReplay(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "feednotifier")
+	defer os.RemoveAll(dir)
+	value := FeedUrl{url: "https://zooqle.com/rss", savePath: filepath.Join(dir, "base")}
+	feed := &gofeed.Feed{Title: "Zooqle TV", Link: "https://zooqle.com"}
+	update := newFeedItem(feed, &gofeed.Item{Title: "The.Expanse.S03E01.PROPER", Link: "https://zooqle.com/2"}, value)
+	update.Previous = &gofeed.Item{Title: "The.Expanse.S03E01"}
+	recordSentItems(value.savePath, []*FeedItem{update})
+	for i := 0; i < maxSentItems; i++ {
+		recordSentItems(value.savePath, []*FeedItem{newFeedItem(feed, &gofeed.Item{Title: "Modern.Family.S09E10"}, value)})
+	}
+
+	sent := loadSentItems(value.savePath)
+	if len(sent) != maxSentItems || sent[0].ID == "" || sent[0].ID == sent[1].ID {
+		t.Fatalf("expected %d items with ids, got %d", maxSentItems, len(sent))
+	}
+	recordSentItems(value.savePath, []*FeedItem{update})
+	item := loadSentItems(value.savePath)[0].feedItem(value)
+	tmpl := template.Must(template.New("t").Parse("{{.Feed.Title}}: {{.Previous.Title}} is now {{.Title}}"))
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, item); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "Zooqle TV: The.Expanse.S03E01 is now The.Expanse.S03E01.PROPER" {
+		t.Errorf("unexpected replayed item %q", out.String())
+	}
+}
@@ -0,0 +1,47 @@
+package feednotifier
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+)
+
+// newServeMux returns the handlers served on the --listen address
+func newServeMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle("/healthz", healthHandler(health.alive))
+	mux.Handle("/readyz", healthHandler(health.ready))
+	mux.Handle("/", private(http.HandlerFunc(dashboardHandler)))
+	mux.Handle("/check", private(http.HandlerFunc(checkHandler)))
+	mux.Handle("/api/feeds", private(sameOrigin(feedsHandler)))
+	mux.Handle("/api/feeds/check", private(sameOrigin(feedCheckHandler)))
+	mux.Handle("/api/items", private(http.HandlerFunc(itemsHandler)))
+	mux.Handle("/api/items/replay", private(sameOrigin(replayHandler)))
+	mux.Handle("/api/notifiers", private(http.HandlerFunc(notifiersHandler)))
+	mux.Handle("/feeds/", private(http.HandlerFunc(feedsOutputHandler)))
+	return mux
+}
+
+// listening is set when the server is started, so notifiers that are only
+// served by it can tell whether anyone can read them
+var listening bool
+
+// SetListening records whether StartServer will be called
+func SetListening(on bool) {
+	listening = on
+}
+
+// StartServer serves the dashboard, the json api, /metrics, /healthz and /readyz on addr
+// in the background
+func StartServer(addr string) *http.Server {
+	server := &http.Server{Addr: addr, Handler: newServeMux()}
+	go func() {
+		log.Infof("Serving dashboard, api, metrics and health checks on %s", addr)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Errorf("Error serving on %s, %v", addr, err)
+		}
+	}()
+	return server
+}
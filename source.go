@@ -0,0 +1,102 @@
+package feednotifier
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// A feed's type option, or the scheme of its url, picks where its items come
+// from. Feeds without one are rss, atom or json feed documents downloaded
+// from their url. Other sources return a feed document too, mostly a json
+// feed they built, so base files, diffs and notifications work the same for
+// all of them.
+//
+//	https://example.org/news type=scrape item=article title=h2 link=a@href
+//	exec:/usr/local/bin/releases args="--all" format=jsonlines
+//	file:///var/lib/reports/feed.xml
+type source func(value FeedUrl) ([]byte, error)
+
+var sources = map[string]source{
+	"scrape": feedSource(scrapeSource),
+	"json":   feedSource(jsonSource),
+	"exec":   execSource,
+	"file":   fileSource,
+	"dir":    feedSource(dirSource),
+}
+
+// feedSource returns a source saving the feed built by build as a json feed
+func feedSource(build func(value FeedUrl) (*gofeed.Feed, error)) source {
+	return func(value FeedUrl) ([]byte, error) {
+		feed, err := build(value)
+		if err != nil {
+			return nil, err
+		}
+		return marshalJSONFeed(feed)
+	}
+}
+
+// localSources run commands or read files on this machine. Feeds using them
+// can be listed in watch files, but the api and telegram bot only add them
+// when allowed with SetAllowLocalFeeds.
+var localSources = map[string]bool{
+	"exec": true,
+	"file": true,
+	"dir":  true,
+}
+
+var allowLocalFeeds bool
+
+// SetAllowLocalFeeds lets the api and telegram bot add feeds of local sources
+func SetAllowLocalFeeds(allow bool) {
+	allowLocalFeeds = allow
+}
+
+// checkRemoteFeed returns an error if a feed added over the api or telegram
+// bot uses a local source and those were not allowed
+func checkRemoteFeed(spec FeedSpec) error {
+	if allowLocalFeeds {
+		return nil
+	}
+	scheme := ""
+	if u, err := url.Parse(spec.URL); err == nil {
+		scheme = u.Scheme
+	}
+	for _, kind := range []string{scheme, spec.Opts["type"]} {
+		if localSources[kind] {
+			return fmt.Errorf("%s feeds can only be added to the watch file", kind)
+		}
+	}
+	return nil
+}
+
+// sourceType returns the type of a feed; "" for feed documents over http
+func sourceType(line string, value FeedUrl) string {
+	if kind := value.opts["type"]; kind != "" {
+		return kind
+	}
+	if u, err := url.Parse(line); err == nil && sources[u.Scheme] != nil {
+		return u.Scheme
+	}
+	return ""
+}
+
+// downloadSource fetches a feed from its source into the base file or, when
+// there is one, a temp file
+func downloadSource(line string, value FeedUrl) (tempfn string, err error) {
+	kind := sourceType(line, value)
+	if kind == "" {
+		return downloadFile(line, value)
+	}
+	src, ok := sources[kind]
+	if !ok {
+		return "", fmt.Errorf("unknown feed type %s for %s", kind, line)
+	}
+	content, err := src(value)
+	if err != nil {
+		return "", err
+	}
+	return saveDownload(line, value.savePath, bytes.NewReader(content))
+}
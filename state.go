@@ -0,0 +1,155 @@
+package feednotifier
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// FeedState records the fetch history of a feed. It is kept next to the
+// feed's base file.
+type FeedState struct {
+	URL         string    `json:"url"`
+	SavePath    string    `json:"-"`
+	LastFetch   time.Time `json:"lastFetch"`
+	LastNewItem time.Time `json:"lastNewItem"`
+	ErrorCount  int       `json:"errorCount"`
+	LastError   string    `json:"lastError,omitempty"`
+	// LastStatus is the http status of the last fetch, 0 if there was no response
+	LastStatus int `json:"lastStatus,omitempty"`
+	// ETag and LastModified are the validators of the last feed response,
+	// sent back so an unchanged feed is answered with 304 Not Modified
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"lastModified,omitempty"`
+	MutedUntil   time.Time `json:"mutedUntil,omitempty"`
+	// title patterns recorded from telegram item buttons
+	Exclude []string `json:"exclude,omitempty"`
+	Like    []string `json:"like,omitempty"`
+	// Recent are the last items sent, newest first
+	Recent []RecentItem `json:"recent,omitempty"`
+}
+
+// RecentItem is an item sent for a feed
+type RecentItem struct {
+	Title  string    `json:"title"`
+	Link   string    `json:"link"`
+	Sent   time.Time `json:"sent"`
+	Update bool      `json:"update,omitempty"`
+}
+
+// maxRecentItems is how many sent items a feed's state keeps
+const maxRecentItems = 20
+
+// stateLock serialises read-modify-write cycles of state files, which are
+// updated by scheduled runs as well as by bot commands
+var stateLock sync.Mutex
+
+// SavePath returns the path of the base file for the feed url under basedir
+func SavePath(basedir, feedURL string) string {
+	u, _ := url.Parse(feedURL)
+	md5hash := md5.Sum([]byte(feedURL))
+	filename := fmt.Sprintf("%x", md5hash)
+	return filepath.Join(basedir, u.Hostname(), filename)
+}
+
+func statePath(savePath string) string {
+	return savePath + ".state"
+}
+
+// LoadFeedState reads the state of a feed; a feed that was never fetched
+// has an empty state.
+func LoadFeedState(basedir, feedURL string) FeedState {
+	return loadState(feedURL, SavePath(basedir, feedURL))
+}
+
+func loadState(feedURL, savePath string) FeedState {
+	state := FeedState{URL: feedURL}
+	content, err := ioutil.ReadFile(statePath(savePath))
+	if err == nil {
+		if err = json.Unmarshal(content, &state); err != nil {
+			log.Warnf("Ignoring corrupt state file for %s - %v", feedURL, err)
+		}
+	}
+	state.URL = feedURL
+	state.SavePath = savePath
+	return state
+}
+
+// updateState applies update to the saved state of a feed
+func updateState(feedURL, savePath string, update func(s *FeedState)) {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	state := loadState(feedURL, savePath)
+	update(&state)
+	state.save()
+}
+
+// MuteFeed stops notifications for a feed until the given time; a zero time
+// unmutes it
+func MuteFeed(basedir, feedURL string, until time.Time) {
+	updateState(feedURL, SavePath(basedir, feedURL), func(s *FeedState) {
+		s.MutedUntil = until
+	})
+}
+
+// Muted reports whether notifications for the feed are currently muted
+func (s FeedState) Muted() bool {
+	return s.MutedUntil.After(time.Now())
+}
+
+func (s *FeedState) save() {
+	if dryRun {
+		return
+	}
+	content, _ := json.MarshalIndent(s, "", "  ")
+	os.MkdirAll(filepath.Dir(s.SavePath), os.ModePerm)
+	if err := ioutil.WriteFile(statePath(s.SavePath), content, 0644); err != nil {
+		log.Errorf("Unable to save state for %s, %v", s.URL, err)
+	}
+}
+
+func (s *FeedState) recordFetch(err error) {
+	s.LastFetch = time.Now()
+	switch e := err.(type) {
+	case nil:
+		s.LastStatus = http.StatusOK
+	case *statusError:
+		s.LastStatus = e.code
+	case *ratelimitError:
+		s.LastStatus = http.StatusTooManyRequests
+	default:
+		s.LastStatus = 0
+	}
+	if err == errNotModified {
+		// an unchanged feed is not an error
+		s.LastStatus, err = http.StatusNotModified, nil
+	}
+	if err != nil {
+		s.ErrorCount++
+		s.LastError = err.Error()
+	} else {
+		s.ErrorCount = 0
+		s.LastError = ""
+	}
+}
+
+// recordSent adds items to the front of the recent items
+func (s *FeedState) recordSent(items []*FeedItem) {
+	var recent []RecentItem
+	for i := len(items) - 1; i >= 0; i-- {
+		recent = append(recent, RecentItem{Title: items[i].Title, Link: items[i].Link, Sent: time.Now(), Update: items[i].IsUpdate()})
+	}
+	s.Recent = append(recent, s.Recent...)
+	if len(s.Recent) > maxRecentItems {
+		s.Recent = s.Recent[:maxRecentItems]
+	}
+}
@@ -0,0 +1,167 @@
+package feednotifier
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// templateFuncs are available to all item templates. ext is rebound to the
+// item being rendered on every execution.
+var templateFuncs = template.FuncMap{
+	"truncate":         truncate,
+	"stripHTML":        stripHTML,
+	"humanizeBytes":    humanizeBytes,
+	"timeAgo":          timeAgo,
+	"escapeMarkdown":   escapeMarkdown,
+	"escapeMarkdownV2": escapeMarkdownV2,
+	"escapeHTML":       escapeHTML,
+	"raw":              raw,
+	"regexReplace":     regexReplace,
+	"default":          defaultValue,
+	"ext":              func(ns, name string) string { return "" },
+}
+
+// truncate shortens s to at most n runes, ending with an ellipsis if cut
+func truncate(n int, s string) string {
+	runes := []rune(s)
+	if n < 0 || len(runes) <= n {
+		return s
+	}
+	if n <= 3 {
+		return string(runes[:n])
+	}
+	return string(runes[:n-3]) + "..."
+}
+
+// stripHTML returns the text content of an html fragment
+func stripHTML(s string) string {
+	var sb strings.Builder
+	tokenizer := html.NewTokenizer(strings.NewReader(s))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return strings.TrimSpace(sb.String())
+		case html.TextToken:
+			sb.Write(tokenizer.Text())
+		}
+	}
+}
+
+// humanizeBytes formats a byte count such as a torrent's contentLength
+func humanizeBytes(v interface{}) (string, error) {
+	var size float64
+	switch b := v.(type) {
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(b), 64)
+		if err != nil {
+			return "", fmt.Errorf("humanizeBytes: %q is not a number", b)
+		}
+		size = f
+	case int:
+		size = float64(b)
+	case int64:
+		size = float64(b)
+	case uint64:
+		size = float64(b)
+	case float64:
+		size = b
+	default:
+		return "", fmt.Errorf("humanizeBytes: unsupported type %T", v)
+	}
+	units := []string{"B", "KB", "MB", "GB", "TB", "PB"}
+	i := 0
+	for size >= 1024 && i < len(units)-1 {
+		size /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%.0f %s", size, units[i]), nil
+	}
+	return fmt.Sprintf("%.1f %s", size, units[i]), nil
+}
+
+// timeAgo describes how long ago t was, e.g. "3 hours ago". Empty values
+// render as "".
+func timeAgo(v interface{}) string {
+	var t time.Time
+	switch tv := v.(type) {
+	case time.Time:
+		t = tv
+	case *time.Time:
+		if tv == nil {
+			return ""
+		}
+		t = *tv
+	default:
+		return ""
+	}
+	d := time.Since(t)
+	if d < 0 {
+		return "just now"
+	}
+	plural := func(n int, unit string) string {
+		if n == 1 {
+			return fmt.Sprintf("1 %s ago", unit)
+		}
+		return fmt.Sprintf("%d %ss ago", n, unit)
+	}
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return plural(int(d/time.Minute), "minute")
+	case d < 24*time.Hour:
+		return plural(int(d/time.Hour), "hour")
+	case d < 30*24*time.Hour:
+		return plural(int(d/(24*time.Hour)), "day")
+	case d < 365*24*time.Hour:
+		return plural(int(d/(30*24*time.Hour)), "month")
+	}
+	return plural(int(d/(365*24*time.Hour)), "year")
+}
+
+var markdownEscaper = strings.NewReplacer("_", "\\_", "*", "\\*", "[", "\\[", "`", "\\`")
+
+// escapeMarkdown escapes the characters that are special in telegram's
+// markdown parse mode
+func escapeMarkdown(v interface{}) string {
+	return markdownEscaper.Replace(fmt.Sprint(v))
+}
+
+func regexReplace(pattern, repl, s string) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", err
+	}
+	return re.ReplaceAllString(s, repl), nil
+}
+
+// defaultValue returns def when v is empty; use as {{.Label | default "none"}}
+func defaultValue(def, v interface{}) interface{} {
+	if v == nil {
+		return def
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		if rv.Len() == 0 {
+			return def
+		}
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return def
+		}
+	default:
+		if rv.IsZero() {
+			return def
+		}
+	}
+	return v
+}
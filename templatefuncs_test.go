@@ -0,0 +1,68 @@
+package feednotifier
+
+import (
+	"os"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func TestTemplateFuncs(t *testing.T) {
+	if s := truncate(10, "Modern Family S09E10"); s != "Modern ..." {
+		t.Errorf("truncate: %q", s)
+	}
+	if s := truncate(30, "short"); s != "short" {
+		t.Errorf("truncate short string: %q", s)
+	}
+	if s := stripHTML("<p>Seeds: <b>12</b> &amp; peers</p>"); s != "Seeds: 12 & peers" {
+		t.Errorf("stripHTML: %q", s)
+	}
+	if s, _ := humanizeBytes("1932735283"); s != "1.8 GB" {
+		t.Errorf("humanizeBytes: %q", s)
+	}
+	if _, err := humanizeBytes("lots"); err == nil {
+		t.Errorf("humanizeBytes should reject non numbers")
+	}
+	hoursAgo := time.Now().Add(-3*time.Hour - time.Minute)
+	if s := timeAgo(&hoursAgo); s != "3 hours ago" {
+		t.Errorf("timeAgo: %q", s)
+	}
+	if s := escapeMarkdown("a_b*c[d]`e"); s != "a\\_b\\*c\\[d]\\`e" {
+		t.Errorf("escapeMarkdown: %q", s)
+	}
+	if s, _ := regexReplace(`\.`, " ", "Modern.Family.S09"); s != "Modern Family S09" {
+		t.Errorf("regexReplace: %q", s)
+	}
+	if v := defaultValue("none", ""); v != "none" {
+		t.Errorf("default: %v", v)
+	}
+	if v := defaultValue("none", "label"); v != "label" {
+		t.Errorf("default: %v", v)
+	}
+}
+
+func TestTemplateContext(t *testing.T) {
+	initTemplates()
+	file, _ := os.Open("test/zooqle.first.xml")
+	defer file.Close()
+	feed, _ := gofeed.NewParser().Parse(file)
+	item := newFeedItem(feed, feed.Items[0], FeedUrl{url: "https://zooqle.com/rss", opts: map[string]string{"tags": "tv, hevc"}})
+
+	tmpl := template.Must(template.New("t").Funcs(templateFuncs).Parse(
+		`{{.Notifier}}|{{.Label | default "nolabel"}}|{{index .Tags 1}}|{{ext "torrent" "seeds"}}|{{.Title | truncate 13}}`))
+	saved := mdTmpl
+	defer func() { mdTmpl = saved }()
+	mdTmpl, _ = mdTmpl.Clone()
+	mdTmpl.AddParseTree("zooqle.com", tmpl.Tree)
+
+	_, text, err := RenderItem("telegram", "markdown", item)
+	expected := "telegram|nolabel|hevc|" + item.Ext("torrent", "seeds") + "|Modern Fam..."
+	if err != nil || text != expected {
+		t.Errorf("expected %q, got %q, %v", expected, text, err)
+	}
+	if item.Ext("torrent", "seeds") == "" {
+		t.Errorf("expected torrent:seeds extension in zooqle feed")
+	}
+}
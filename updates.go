@@ -0,0 +1,156 @@
+package feednotifier
+
+import (
+	"os"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+	"golang.org/x/net/html"
+)
+
+// updateTemplate is the built in template for updated items; custom
+// templates override it by defining "update" or "<notifier>/update"
+const updateTemplate = "__update"
+
+// compareUpdates returns the items of the new feed that are also in base
+// but whose updated date or content changed, with Previous set to the base
+// version
+func compareUpdates(value FeedUrl, base, new string, key identity) ([]*FeedItem, error) {
+	oldfh, err := os.Open(base)
+	if err != nil {
+		return nil, err
+	}
+	defer oldfh.Close()
+	oldfeed, err := ParseFeed(oldfh)
+	if err != nil {
+		return nil, err
+	}
+	newfh, err := os.Open(new)
+	if err != nil {
+		return nil, err
+	}
+	defer newfh.Close()
+	newFeed, err := ParseFeed(newfh)
+	if err != nil {
+		return nil, err
+	}
+
+	previous := make(map[string]*gofeed.Item, len(oldfeed.Items))
+	for _, item := range oldfeed.Items {
+		previous[key(item)] = item
+	}
+	var updated []*FeedItem
+	for _, item := range newFeed.Items {
+		old, found := previous[key(item)]
+		if !found || !itemChanged(old, item) {
+			continue
+		}
+		feedItem := newFeedItem(newFeed, item, value)
+		feedItem.Previous = old
+		updated = append(updated, feedItem)
+	}
+	return updated, nil
+}
+
+// itemChanged compares the updated dates of both versions when they have
+// one and their content otherwise
+func itemChanged(old, new *gofeed.Item) bool {
+	if old.Updated != "" && new.Updated != "" {
+		return old.Updated != new.Updated
+	}
+	fields := []string{"title", "description", "content"}
+	return contentHash(old, fields) != contentHash(new, fields)
+}
+
+// IsUpdate reports whether the item is a changed version of an item sent before
+func (i *FeedItem) IsUpdate() bool {
+	return i.Previous != nil
+}
+
+// TitleDiff is a line diff of the previous and current title, "" when the
+// title did not change
+func (i *FeedItem) TitleDiff() string {
+	if i.Previous == nil {
+		return ""
+	}
+	return lineDiff(i.Previous.Title, i.Title)
+}
+
+// DescriptionDiff is a line diff of the text of the previous and current
+// description, "" when it did not change
+func (i *FeedItem) DescriptionDiff() string {
+	if i.Previous == nil {
+		return ""
+	}
+	return lineDiff(htmlText(i.Previous.Description), htmlText(i.Description))
+}
+
+// htmlText is the text of an html fragment with block elements on lines of
+// their own
+func htmlText(s string) string {
+	var sb strings.Builder
+	tokenizer := html.NewTokenizer(strings.NewReader(s))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return sb.String()
+		case html.TextToken:
+			sb.Write(tokenizer.Text())
+		case html.StartTagToken, html.SelfClosingTagToken, html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			switch string(name) {
+			case "br", "p", "div", "li", "tr", "h1", "h2", "h3", "h4", "h5", "h6":
+				sb.WriteString("\n")
+			}
+		}
+	}
+}
+
+// lineDiff returns the lines removed from old prefixed with "- " and the
+// lines added in new prefixed with "+ ", in order; unchanged lines are left out
+func lineDiff(old, new string) string {
+	a, b := diffLines(old), diffLines(new)
+	// lcs[i][j] is the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var sb strings.Builder
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] > lcs[i+1][j]):
+			sb.WriteString("+ " + b[j] + "\n")
+			j++
+		default:
+			sb.WriteString("- " + a[i] + "\n")
+			i++
+		}
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// diffLines splits text into trimmed, non blank lines
+func diffLines(s string) []string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,51 @@
+package feednotifier
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLineDiff(t *testing.T) {
+	tests := []struct {
+		old, new, want string
+	}{
+		{"Investigating API errors", "Resolved: API errors", "- Investigating API errors\n+ Resolved: API errors"},
+		{"a\nb\nc", "a\nc\nd", "- b\n+ d"},
+		{"same", "same", ""},
+		{"", "added", "+ added"},
+	}
+	for _, test := range tests {
+		if got := lineDiff(test.old, test.new); got != test.want {
+			t.Errorf("diff %q %q: expected %q, got %q", test.old, test.new, test.want, got)
+		}
+	}
+}
+
+func TestCompareUpdates(t *testing.T) {
+	initTemplates()
+	value := FeedUrl{url: "https://status.example.com/rss"}
+	updates, err := compareUpdates(value, "test/status.first.xml", "test/status.second.xml", autoIdentity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updates) != 1 || updates[0].Title != "Resolved: API errors" || !updates[0].IsUpdate() {
+		t.Fatalf("expected the resolved incident as update, got %d items", len(updates))
+	}
+	item := updates[0]
+	if diff := item.DescriptionDiff(); diff != "+ A fix has been deployed." {
+		t.Errorf("unexpected description diff %q", diff)
+	}
+
+	name, text, err := RenderItem("telegram", "markdownv2", item)
+	if err != nil || name != updateTemplate {
+		t.Fatalf("expected built in update template, got %s, %v", name, err)
+	}
+	if !strings.Contains(text, `\- Investigating API errors`) || !strings.Contains(text, `\+ A fix has been deployed\.`) {
+		t.Errorf("expected escaped diffs in update message, got %s", text)
+	}
+	// items that are not updates keep using the item templates
+	item.Previous = nil
+	if name := templateFor("telegram", item); name != defaultTemplate {
+		t.Errorf("expected default template for new items, got %s", name)
+	}
+}
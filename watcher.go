@@ -3,7 +3,7 @@ package feednotifier
 //go:generate fileb0x b0x.toml
 import (
 	"bufio"
-	"crypto/md5"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -13,7 +13,9 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
@@ -25,6 +27,15 @@ import (
 
 var didInitXslts bool
 
+// dryRun disables every side effect of a run: notifiers only print and base
+// files are never written or removed.
+var dryRun bool
+
+// SetDryRun turns dry-run mode on or off for all monitored files.
+func SetDryRun(enabled bool) {
+	dryRun = enabled
+}
+
 func initXslt() {
 	if didInitXslts {
 		return
@@ -42,10 +53,24 @@ func (e *ratelimitError) Error() string {
 	return fmt.Sprintf("Rate limited - retry after %v", e.retryDuration)
 }
 
+// statusError is a non 200 response to a feed request
+type statusError struct {
+	code   int
+	status string
+	body   []byte
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("Got non 200 response for feed %s: %s", e.status, e.body)
+}
+
 type FeedUrl struct {
 	url      string
 	savePath string
+	basedir  string
+	file     string
 	added    time.Time
+	opts     map[string]string
 }
 
 func (f FeedUrl) String() string {
@@ -59,6 +84,14 @@ type MonitoredFile struct {
 	watcher   *fsnotify.Watcher
 	notifiers *[]Notifier
 	basedir   string
+	nextRun   time.Time
+	// lock guards urls and nextRun, which the dashboard reads
+	lock sync.RWMutex
+	// runLock keeps reloads, scheduled runs and manual checks from
+	// processing the same feeds at once
+	runLock sync.Mutex
+	// dirWatchers watch the folders of dir:// feeds, by feed url
+	dirWatchers map[string]*fsnotify.Watcher
 }
 
 func NewMonitoredFile(filename string, interval uint64, notifiers *[]Notifier, basedir string) *MonitoredFile {
@@ -69,37 +102,46 @@ func NewMonitoredFile(filename string, interval uint64, notifiers *[]Notifier, b
 	mf.notifiers = notifiers
 	mf.watcher, _ = fsnotify.NewWatcher()
 	mf.basedir = basedir
+	health.watchFile(filename, time.Duration(interval)*time.Minute)
 	mf.initFile()
 	initXslt()
+	registerMonitoredFile(&mf)
 	return &mf
 }
 
 func (mf *MonitoredFile) initFile() error {
+	mf.runLock.Lock()
+	defer mf.runLock.Unlock()
 	time := time.Now()
-	err := ReadLines(mf.filename, " \r\n", func(line string) error {
-		if line != "" {
-			url, _ := url.Parse(line)
-			md5hash := md5.Sum([]byte(line))
-			filename := fmt.Sprintf("%x", md5hash)
-			base := filepath.Join(mf.basedir, url.Hostname(), filename)
-			_, exists := mf.urls[line]
-			mf.urls[line] = FeedUrl{url: line, savePath: base, added: time}
-			if !exists {
-				processLine(line, mf.urls[line], *mf.notifiers)
-			}
-		}
-		return nil
-	})
+	wf, err := LoadWatchFile(mf.filename)
 	if err != nil {
+		log.Errorf("error loading watch file %v", err)
 		return err
 	}
+	health.fileLoaded(mf.filename)
+	for _, spec := range wf.Feeds() {
+		value := FeedUrl{url: spec.URL, savePath: SavePath(mf.basedir, spec.URL), basedir: mf.basedir, file: mf.filename, added: time, opts: spec.Opts}
+		mf.lock.Lock()
+		_, exists := mf.urls[spec.URL]
+		mf.urls[spec.URL] = value
+		mf.lock.Unlock()
+		if !exists {
+			processLine(spec.URL, value, *mf.notifiers)
+		}
+	}
 	log.Debugf("Checking to see if there are any old urls to be cleaned")
 	urlsRemovedNotification := ""
+	mf.lock.Lock()
+	defer mf.lock.Unlock()
 	for k, v := range mf.urls {
 		if v.added.Before(time) {
 			log.Debugf("Url %s not added now - will be deleted", k)
-			os.Remove(v.savePath)
-			log.Debugf("Removed file: %s", v.savePath)
+			if !dryRun {
+				os.Remove(v.savePath)
+				os.Remove(statePath(v.savePath))
+				os.Remove(sentPath(v.savePath))
+				log.Debugf("Removed file: %s", v.savePath)
+			}
 			delete(mf.urls, k)
 			urlsRemovedNotification = fmt.Sprintf("%s\nRemoved URL: %s", urlsRemovedNotification, k)
 		}
@@ -109,6 +151,7 @@ func (mf *MonitoredFile) initFile() error {
 			notifier.Notify(urlsRemovedNotification)
 		}
 	}
+	mf.watchDirs()
 	log.Debugf("Final list of %d urls to be monitored: %v", len(mf.urls), mf.urls)
 	return nil
 }
@@ -117,9 +160,15 @@ func (mf *MonitoredFile) Start() {
 	job := func(f *MonitoredFile) {
 		nextRun := time.Now().Add(time.Duration(f.interval) * time.Minute)
 		log.Debug("Starting scheduled run: ")
-		for line, value := range f.urls {
-			processLine(line, value, *mf.notifiers)
+		health.tick()
+		f.lock.Lock()
+		f.nextRun = nextRun
+		f.lock.Unlock()
+		f.runLock.Lock()
+		for _, value := range f.feeds() {
+			processLine(value.url, value, *mf.notifiers)
 		}
+		f.runLock.Unlock()
 		log.Debugf("Completed scheduled run: Sleeping for %d minutes.", f.interval)
 		log.Debugf("Next run at %v", nextRun)
 		log.Info("*************************************")
@@ -154,6 +203,11 @@ func (mf *MonitoredFile) Start() {
 						if wasRemoveEvent {
 							mf.watcher.Add(mf.filename)
 						}
+						result := "ok"
+						if err != nil {
+							result = "error"
+						}
+						watchFileReloadsTotal.WithLabelValues(mf.filename, result).Inc()
 						if err != nil {
 							log.Errorf("file %s could not be read. Error %v", mf.filename, err)
 						}
@@ -166,40 +220,148 @@ func (mf *MonitoredFile) Start() {
 		}
 		cleanup()
 	}()
+	mf.lock.Lock()
+	mf.nextRun = time.Now().Add(time.Duration(mf.interval) * time.Minute)
+	mf.lock.Unlock()
 	gocron.Every(mf.interval).Minutes().Do(job, mf)
 }
 
-func downloadFile(line, base string) (tempfn string, err error) {
+// feeds returns the monitored feeds sorted by url
+func (mf *MonitoredFile) feeds() []FeedUrl {
+	mf.lock.RLock()
+	defer mf.lock.RUnlock()
+	feeds := make([]FeedUrl, 0, len(mf.urls))
+	for _, value := range mf.urls {
+		feeds = append(feeds, value)
+	}
+	sort.Slice(feeds, func(i, j int) bool { return feeds[i].url < feeds[j].url })
+	return feeds
+}
+
+// CheckNow processes a feed outside the schedule, after any run in
+// progress. It returns false if the file does not monitor feedURL.
+func (mf *MonitoredFile) CheckNow(feedURL string) bool {
+	mf.lock.RLock()
+	value, ok := mf.urls[feedURL]
+	mf.lock.RUnlock()
+	if !ok {
+		return false
+	}
+	go func() {
+		mf.runLock.Lock()
+		defer mf.runLock.Unlock()
+		log.Infof("Checking %s now", feedURL)
+		processLine(feedURL, value, *mf.notifiers)
+	}()
+	return true
+}
+
+// fetch gets a feed url with the http settings of the feed's options, see
+// HTTPOptions. Non 200 responses are returned as errors; the caller must
+// close the response body.
+func fetch(line string, opts map[string]string) (*http.Response, error) {
+	return fetchIfModified(line, opts, "", "")
+}
+
+// errNotModified is returned when a feed is unchanged since the validators
+// passed to fetchIfModified
+var errNotModified = errors.New("feed not modified")
+
+// fetchIfModified is fetch with the ETag and Last-Modified of an earlier
+// response sent as If-None-Match and If-Modified-Since
+func fetchIfModified(line string, opts map[string]string, etag, lastModified string) (*http.Response, error) {
 	url, err := url.Parse(line)
 	if err != nil {
 		log.Errorf("Unable to parse url %v\n", err)
-		return
+		return nil, err
+	}
+	settings, err := feedHTTPSettings(opts)
+	if err != nil {
+		return nil, err
+	}
+	client, err := settings.client()
+	if err != nil {
+		return nil, err
+	}
+	req, err := settings.newRequest(url.String())
+	if err != nil {
+		return nil, err
 	}
-	// "User-Agent: Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:73.0) Gecko/20100101 Firefox/73.0"
-	client := &http.Client{}
-	req, _ := http.NewRequest(http.MethodGet, url.String(), nil)
-	req.Header.Add("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:73.0) Gecko/20100101 Firefox/73.0")
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+	start := time.Now()
 	r, err := client.Do(req)
 	if err != nil {
+		observeFetch(line, 0, start)
 		log.Errorf("Error downloading from url: %s, %v\n", url, err)
-		return
+		return nil, err
+	}
+	observeFetch(line, r.StatusCode, start)
+	if r.StatusCode == http.StatusNotModified {
+		r.Body.Close()
+		notModifiedTotal.WithLabelValues(feedLabel(line)).Inc()
+		return nil, errNotModified
 	}
-	defer r.Body.Close()
 	if r.StatusCode != 200 {
+		defer r.Body.Close()
 		if r.StatusCode == 429 {
+			rateLimitedTotal.WithLabelValues(feedLabel(line)).Inc()
 			retry := r.Header.Get("X-Ratelimit-Retryafter")
 			duration, _ := time.ParseDuration(retry)
-			err = &ratelimitError{duration}
-			return
+			return nil, &ratelimitError{duration}
 		}
 		log.Errorf("Error downloading from url %s, status code: %d", url, r.StatusCode)
 		resp, _ := ioutil.ReadAll(bufio.NewReader(r.Body))
-		err = fmt.Errorf("Got non 200 response for feed %s: %s", r.Status, resp)
+		return nil, &statusError{r.StatusCode, r.Status, resp}
+	}
+	return r, nil
+}
+
+// FetchFeed downloads and parses a feed without touching any saved state
+func FetchFeed(feedURL string) (*gofeed.Feed, error) {
+	r, err := fetch(feedURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	return ParseFeed(r.Body)
+}
+
+func downloadFile(line string, value FeedUrl) (tempfn string, err error) {
+	var etag, lastModified string
+	// without a base file there is nothing a 304 could refer to
+	if _, err := os.Stat(value.savePath); err == nil {
+		state := loadState(line, value.savePath)
+		etag, lastModified = state.ETag, state.LastModified
+	}
+	r, err := fetchIfModified(line, value.opts, etag, lastModified)
+	if err != nil {
+		return
+	}
+	defer r.Body.Close()
+	if tempfn, err = saveDownload(line, value.savePath, r.Body); err == nil {
+		updateState(line, value.savePath, func(s *FeedState) {
+			s.ETag, s.LastModified = r.Header.Get("ETag"), r.Header.Get("Last-Modified")
+		})
+	}
+	return
+}
+
+// saveDownload writes a fetched feed to the base file if there is none yet,
+// returning "", and to a temp file otherwise
+func saveDownload(line, base string, body io.Reader) (tempfn string, err error) {
+	url, err := url.Parse(line)
+	if err != nil {
+		log.Errorf("Unable to parse url %v\n", err)
 		return
 	}
 	// file not exists
 	tempfn = ""
-	if _, err = os.Stat(base); os.IsNotExist(err) {
+	if _, err = os.Stat(base); os.IsNotExist(err) && !dryRun {
 		os.MkdirAll(filepath.Dir(base), os.ModePerm)
 		var fw *os.File
 		fw, err = os.Create(base)
@@ -209,9 +371,10 @@ func downloadFile(line, base string) (tempfn string, err error) {
 		}
 		defer fw.Close()
 		log.Info("Base file does not exist for url: ", line, "; creating", base)
-		io.Copy(fw, r.Body)
+		n, _ := io.Copy(fw, body)
+		fetchBytes.WithLabelValues(feedLabel(line)).Add(float64(n))
 	} else {
-		// base file exists; write to temp
+		// base file exists (or dry run); write to temp
 		var tmp *os.File
 		tmp, err = ioutil.TempFile("", url.Hostname())
 		if err != nil {
@@ -221,12 +384,14 @@ func downloadFile(line, base string) (tempfn string, err error) {
 		defer tmp.Close()
 		tempfn = tmp.Name()
 		log.Info("Base file exists; creating temp file: ", tempfn)
-		io.Copy(tmp, r.Body)
+		n, _ := io.Copy(tmp, body)
+		fetchBytes.WithLabelValues(feedLabel(line)).Add(float64(n))
 	}
 	return
 }
 
-func compareFeeds(xslt, base, temp string) ([]*gofeed.Item, error) {
+// compareFeeds returns the new feed with only the items not in base
+func compareFeeds(xslt, base, temp string) (*gofeed.Feed, error) {
 
 	baseXSLTParam := base
 	if runtime.GOOS == "windows" {
@@ -258,15 +423,13 @@ func compareFeeds(xslt, base, temp string) ([]*gofeed.Item, error) {
 		return nil, err
 	}
 
-	return feed.Items, nil
+	return feed, nil
 
 }
 
-func compareFeedsInProc(base, new string) ([]*gofeed.Item, error) {
-	var idlist map[string]*gofeed.Item
-	idlist = make(map[string]*gofeed.Item)
-	fp := gofeed.NewParser()
-
+// compareFeedsInProc returns the new feed with only the items not in base,
+// matching items by key
+func compareFeedsInProc(base, new string, key identity) (*gofeed.Feed, error) {
 	fh, err := os.Open(new)
 	if err != nil {
 		log.Errorf("Could not open new file - %s", new)
@@ -274,14 +437,11 @@ func compareFeedsInProc(base, new string) ([]*gofeed.Item, error) {
 	}
 	defer fh.Close()
 
-	newFeed, err := fp.Parse(fh)
+	newFeed, err := ParseFeed(fh)
 	if err != nil {
 		log.Errorf("Could not parse new file - %s, %v", new, err)
 		return nil, err
 	}
-	for _, item := range newFeed.Items {
-		idlist[item.GUID] = item
-	}
 
 	oldfh, err := os.Open(base)
 	if err != nil {
@@ -289,24 +449,29 @@ func compareFeedsInProc(base, new string) ([]*gofeed.Item, error) {
 		return nil, err
 	}
 	defer oldfh.Close()
-	oldfeed, err := fp.Parse(oldfh)
+	oldfeed, err := ParseFeed(oldfh)
 	if err != nil {
 		log.Errorf("Could not parse base feed - %s, %v", base, err)
 		return nil, err
 	}
+	known := make(map[string]bool, len(oldfeed.Items))
 	for _, item := range oldfeed.Items {
-		if _, found := idlist[item.GUID]; found {
-			delete(idlist, item.GUID)
-		}
+		known[key(item)] = true
 	}
 
-	var itemList []*gofeed.Item
-	itemList = make([]*gofeed.Item, 0, len(idlist))
-	for _, v := range idlist {
-		itemList = append(itemList, v)
+	itemList := make([]*gofeed.Item, 0, len(newFeed.Items))
+	for _, item := range newFeed.Items {
+		id := key(item)
+		if known[id] {
+			continue
+		}
+		// feeds sometimes repeat an item; send it once
+		known[id] = true
+		itemList = append(itemList, item)
 	}
+	newFeed.Items = itemList
 
-	return itemList, nil
+	return newFeed, nil
 }
 func getTransformFile(line string) (string, error) {
 	url, err := url.Parse(line)
@@ -334,8 +499,8 @@ func processLine(line string, value FeedUrl, notifiers []Notifier) error {
 	var tmpfile string
 	var err error
 	for !success && retries < 3 {
-		tmpfile, err = downloadFile(line, value.savePath)
-		if err == nil {
+		tmpfile, err = downloadSource(line, value)
+		if err == nil || err == errNotModified {
 			success = true
 		}
 		if re, ok := err.(*ratelimitError); ok {
@@ -344,49 +509,198 @@ func processLine(line string, value FeedUrl, notifiers []Notifier) error {
 			time.Sleep(re.retryDuration)
 		}
 	}
+	fetchErr, foundNew := err, false
+	defer func() {
+		updateState(line, value.savePath, func(s *FeedState) {
+			s.recordFetch(fetchErr)
+			if foundNew {
+				s.LastNewItem = time.Now()
+			}
+		})
+	}()
+	if err == errNotModified {
+		log.Infof("Feed %s not modified since the last fetch", line)
+		return nil
+	}
 	if err != nil {
 		log.Errorf("Error downloading: %s, %v", line, err)
 		return nil
 	}
 	// process the delta here
 	log.Infof("File downloaded %s, %s", value.savePath, tmpfile)
-	if tmpfile == "" {
+	if tmpfile != "" {
+		defer os.Remove(tmpfile)
+	}
+	if _, err := os.Stat(value.savePath); tmpfile == "" || os.IsNotExist(err) {
 		log.Infof("Send push notification to acknowledge new feed url %s", line)
 		for _, notifier := range notifiers {
 			notifier.Notify(fmt.Sprintf("New url %s monitored. Base file %s", line, value.savePath))
 		}
+		if initial := intOption(value, "initial-items", 0); initial > 0 {
+			feedFile := value.savePath
+			if tmpfile != "" {
+				feedFile = tmpfile
+			}
+			feed, err := parseFeedFile(feedFile)
+			if err != nil {
+				log.Errorf("Could not parse new feed %s, %v", line, err)
+				return nil
+			}
+			log.Infof("Sending the latest %d items of new feed %s", initial, line)
+			pushItems(line, value, feed, feed.Items, nil, initial, notifiers)
+		}
 	} else {
 		// compare temp with base
 		// if new items found
 		//		send pushes
+		key, err := parseIdentity(value.opts["id"])
+		if err != nil {
+			log.Warnf("Using automatic item identity for %s - %v", line, err)
+			key = autoIdentity
+		}
 		xslt, err := getTransformFile(line)
-		var newItems []*gofeed.Item
+		var diff *gofeed.Feed
+		engine := engineInProc
 		if err != nil {
 			log.Warnf("Could not get transform file - %v", err)
 			log.Info("Falling back to in proc comparison")
-			newItems, err = compareFeedsInProc(value.savePath, tmpfile)
+			diff, err = compareFeedsInProc(value.savePath, tmpfile, key)
+		} else if format := feedFormat(tmpfile); format != feedRSS {
+			// the transforms select /rss/channel/item
+			log.Infof("Feed %s is not rss (%s), not applying xslt %s", line, format, xslt)
+			diff, err = compareFeedsInProc(value.savePath, tmpfile, key)
+		} else if !usesGUID(value.opts["id"]) {
+			log.Infof("Feed %s is compared by %s, not applying xslt %s", line, value.opts["id"], xslt)
+			diff, err = compareFeedsInProc(value.savePath, tmpfile, key)
 		} else {
-			newItems, err = compareFeeds(xslt, value.savePath, tmpfile)
+			engine = engineXSLT
+			diff, err = compareFeeds(xslt, value.savePath, tmpfile)
 			if err != nil {
 				log.Warnf("Error comparing feeds with xslt: %s,  %v", xslt, err)
 				log.Info("Falling back to in proc comparison")
-				newItems, err = compareFeedsInProc(value.savePath, tmpfile)
+				engine = engineInProcFallback
+				diff, err = compareFeedsInProc(value.savePath, tmpfile, key)
+			} else if missingGUID(diff.Items) {
+				// the transforms match on guid and let every item without one through
+				log.Infof("Feed %s has items without guid, falling back to in proc comparison", line)
+				engine = engineInProcFallback
+				diff, err = compareFeedsInProc(value.savePath, tmpfile, key)
 			}
 		}
-		if len(newItems) > 0 {
-			defer os.Remove(tmpfile)
-			log.Infof("Feed diff has %d new items", len(newItems))
-			copyFile(tmpfile, value.savePath)
-
-			log.Infof("Pushing %d new items found in feed %s", len(newItems), line)
-			for _, item := range newItems {
-				for _, notifier := range notifiers {
-					notifier.NotifyItem(line, item)
-				}
+		diffsTotal.WithLabelValues(engine).Inc()
+		var newItems []*gofeed.Item
+		if err == nil {
+			newItems = diff.Items
+			newItemsTotal.WithLabelValues(feedLabel(line)).Add(float64(len(newItems)))
+		} else {
+			// compare the whole feed next time rather than trust a 304
+			updateState(line, value.savePath, func(s *FeedState) {
+				s.ETag, s.LastModified = "", ""
+			})
+		}
+		var updates []*FeedItem
+		if value.opts["updates"] == "true" {
+			if updates, err = compareUpdates(value, value.savePath, tmpfile, key); err != nil {
+				log.Errorf("Could not compare items of %s for updates, %v", line, err)
+			}
+		}
+		if len(newItems) > 0 || len(updates) > 0 {
+			log.Infof("Feed diff has %d new and %d updated items", len(newItems), len(updates))
+			if dryRun {
+				log.Infof("Dry run - not updating base file %s", value.savePath)
+			} else {
+				copyFile(tmpfile, value.savePath)
 			}
+			foundNew = len(newItems) > 0
+			pushItems(line, value, diff, newItems, updates, intOption(value, "max-items-per-run", maxItemsPerRun), notifiers)
 		} else {
 			log.Infof("No new items found in feed %s", line)
 		}
 	}
 	return nil
 }
+
+func parseFeedFile(fn string) (*gofeed.Feed, error) {
+	fh, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+	return ParseFeed(fh)
+}
+
+// pushItems filters the new items of a feed and sends at most maxItems of
+// them, followed by updates of items sent before
+func pushItems(line string, value FeedUrl, feed *gofeed.Feed, newItems []*gofeed.Item, updates []*FeedItem, maxItems int, notifiers []Notifier) {
+	state := loadState(line, value.savePath)
+	if state.Muted() {
+		log.Infof("Feed %s is muted until %v - not pushing %d new items", line, state.MutedUntil, len(newItems)+len(updates))
+		return
+	}
+	newItems = dropOldItems(newItems, value)
+	newItems = excludeItems(newItems, value, state)
+	likes := compilePatterns(line, state.Like)
+	var feedItems []*FeedItem
+	for _, item := range newItems {
+		feedItem := newFeedItem(feed, item, value)
+		feedItem.Liked = matchesAny(item.Title, likes)
+		feedItems = append(feedItems, feedItem)
+	}
+	feedItems = filterQuality(feedItems, value)
+	feedItems = dedupeItems(feedItems, value)
+	feedItems = dedupeEpisodes(feedItems, value)
+	feedItems = latestItems(feedItems, maxItems, value)
+	client, clientName := downloadClientFor(value)
+	if clientName != "" && client == nil {
+		log.Warnf("Feed %s uses unknown download client %s", line, clientName)
+	}
+	log.Infof("Pushing %d new items found in feed %s", len(feedItems), line)
+	var notified []*FeedItem
+	for _, feedItem := range feedItems {
+		if client != nil {
+			if err := addTorrent(client, clientName, feedItem); err != nil {
+				log.Errorf("Error adding %s to download client %s, %v", feedItem.Title, clientName, err)
+			} else {
+				feedItem.Downloaded = true
+			}
+		}
+		if notifyItem(notifiers, feedItem) {
+			notified = append(notified, feedItem)
+		}
+	}
+	recordSeen(notified, value)
+	recordEpisodes(notified, value)
+	// updates are of items already sent, so dedupe and downloads don't apply
+	excludes := excludePatterns(value, state)
+	for _, feedItem := range updates {
+		if matchesAny(feedItem.Title, excludes) || matchesAny(feedItem.Previous.Title, excludes) {
+			continue
+		}
+		feedItem.Liked = matchesAny(feedItem.Title, likes)
+		log.Infof("Pushing update of item %s in feed %s", feedItem.Title, line)
+		notifyItem(notifiers, feedItem)
+		feedItems = append(feedItems, feedItem)
+	}
+	if len(feedItems) > 0 {
+		updateState(line, value.savePath, func(s *FeedState) {
+			s.recordSent(feedItems)
+		})
+		recordSentItems(value.savePath, feedItems)
+	}
+}
+
+// notifyItem sends an item to each notifier and reports whether it reached
+// any of them; with no notifiers there is nothing to fail
+func notifyItem(notifiers []Notifier, item *FeedItem) bool {
+	ok := len(notifiers) == 0
+	for _, notifier := range notifiers {
+		err := notifier.NotifyItem(item)
+		observeNotification(notifier, err)
+		if err != nil {
+			log.Errorf("Error notifying %v of item %s, %v", notifier, item.Title, err)
+			continue
+		}
+		ok = true
+	}
+	return ok
+}
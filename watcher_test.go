@@ -0,0 +1,107 @@
+package feednotifier
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func serveFile(fn *string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, *fn)
+	}))
+}
+
+func TestProcessLineDryRun(t *testing.T) {
+	initTemplates()
+	current := "test/zooqle.first.xml"
+	ts := serveFile(&current)
+	defer ts.Close()
+	dir, _ := ioutil.TempDir("", "feednotifier")
+	defer os.RemoveAll(dir)
+	base := filepath.Join(dir, "base")
+
+	SetDryRun(true)
+	defer SetDryRun(false)
+	out := &bytes.Buffer{}
+	notifiers := []Notifier{NewDryRunNotifier(newPushover("abc", "def"), out)}
+	processLine(ts.URL, FeedUrl{url: ts.URL, savePath: base}, notifiers)
+	if _, err := os.Stat(base); !os.IsNotExist(err) {
+		t.Errorf("base file should not be created on a dry run")
+	}
+	if !strings.Contains(out.String(), "New url") {
+		t.Errorf("expected acknowledgement message, got %s", out.String())
+	}
+
+	copyFile("test/zooqle.first.xml", base)
+	current = "test/zooqle.second.xml"
+	out.Reset()
+	processLine(ts.URL, FeedUrl{url: ts.URL, savePath: base}, notifiers)
+	if !strings.Contains(out.String(), "template: __message") {
+		t.Errorf("expected rendered item, got %s", out.String())
+	}
+	saved, _ := ioutil.ReadFile(base)
+	first, _ := ioutil.ReadFile("test/zooqle.first.xml")
+	if !bytes.Equal(saved, first) {
+		t.Errorf("base file should not be updated on a dry run")
+	}
+}
+
+func TestProcessLineInitialItems(t *testing.T) {
+	initTemplates()
+	current := "test/zooqle.first.xml"
+	ts := serveFile(&current)
+	defer ts.Close()
+	dir, _ := ioutil.TempDir("", "feednotifier")
+	defer os.RemoveAll(dir)
+
+	SetDryRun(true)
+	defer SetDryRun(false)
+	out := &bytes.Buffer{}
+	notifiers := []Notifier{NewDryRunNotifier(newPushover("abc", "def"), out)}
+	value := FeedUrl{url: ts.URL, savePath: filepath.Join(dir, "base"), basedir: dir, opts: map[string]string{"initial-items": "2"}}
+	processLine(ts.URL, value, notifiers)
+	if !strings.Contains(out.String(), "New url") {
+		t.Errorf("expected acknowledgement message, got %s", out.String())
+	}
+	if n := strings.Count(out.String(), "template: __message"); n != 2 {
+		t.Errorf("expected the latest 2 items to be sent, got %d", n)
+	}
+}
+
+func TestProcessLineNotModified(t *testing.T) {
+	initTemplates()
+	current := "test/zooqle.first.xml"
+	ts := serveFile(&current)
+	defer ts.Close()
+	dir, _ := ioutil.TempDir("", "feednotifier")
+	defer os.RemoveAll(dir)
+
+	value := FeedUrl{url: ts.URL, savePath: filepath.Join(dir, "base"), basedir: dir}
+	processLine(ts.URL, value, nil)
+	if state := loadState(ts.URL, value.savePath); state.LastModified == "" {
+		t.Fatalf("expected the last modified time to be kept, got %+v", state)
+	}
+	processLine(ts.URL, value, nil)
+	state := loadState(ts.URL, value.savePath)
+	if state.LastStatus != http.StatusNotModified || state.ErrorCount != 0 {
+		t.Errorf("expected an unchanged feed to be a 304 without errors, got %+v", state)
+	}
+
+	mux := httptest.NewServer(newServeMux())
+	defer mux.Close()
+	resp, err := http.Get(mux.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if metric := `feednotifier_not_modified_total{feed="` + ts.URL + `"} 1`; !strings.Contains(string(body), metric) {
+		t.Errorf("expected %s in metrics", metric)
+	}
+}
@@ -0,0 +1,207 @@
+package feednotifier
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// A watch file lists one feed per line. The url may be followed by options
+// in key=value form; values containing spaces are double quoted. Blank lines
+// and lines starting with # are ignored but kept when the file is rewritten,
+// as are malformed lines, which are logged and skipped.
+//
+//	# tv shows
+//	https://zooqle.com/search?q=modern+family&fmt=rss label="Modern Family" tags=tv
+
+// FeedSpec is a single feed declared in a watch file
+type FeedSpec struct {
+	URL  string
+	Opts map[string]string
+}
+
+func (f FeedSpec) String() string {
+	return formatWatchLine(f)
+}
+
+type watchLine struct {
+	raw  string
+	spec *FeedSpec
+}
+
+// WatchFile is an editable, in memory copy of a watch file
+type WatchFile struct {
+	Filename string
+	lines    []watchLine
+}
+
+// parseWatchLine parses a line from a watch file. A nil spec is returned for
+// blank lines and comments.
+func parseWatchLine(line string) (*FeedSpec, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil, nil
+	}
+	tokens, err := splitWatchLine(line)
+	if err != nil {
+		return nil, err
+	}
+	spec := &FeedSpec{URL: tokens[0], Opts: make(map[string]string)}
+	if _, err := url.Parse(spec.URL); err != nil {
+		return nil, fmt.Errorf("invalid url %s - %v", spec.URL, err)
+	}
+	for _, token := range tokens[1:] {
+		kv := strings.SplitN(token, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid option %q for %s - expected key=value", token, spec.URL)
+		}
+		spec.Opts[kv[0]] = kv[1]
+	}
+	return spec, nil
+}
+
+// splitWatchLine splits on whitespace, honouring double quotes
+func splitWatchLine(line string) ([]string, error) {
+	var tokens []string
+	var current strings.Builder
+	inQuotes, inToken := false, false
+	for _, r := range line {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+			inToken = true
+		case !inQuotes && (r == ' ' || r == '\t'):
+			if inToken {
+				tokens = append(tokens, current.String())
+				current.Reset()
+				inToken = false
+			}
+		default:
+			current.WriteRune(r)
+			inToken = true
+		}
+	}
+	if inQuotes {
+		return nil, fmt.Errorf("unterminated quote in line: %s", line)
+	}
+	if inToken {
+		tokens = append(tokens, current.String())
+	}
+	return tokens, nil
+}
+
+func formatWatchLine(spec FeedSpec) string {
+	keys := make([]string, 0, len(spec.Opts))
+	for k := range spec.Opts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := []string{spec.URL}
+	for _, k := range keys {
+		v := spec.Opts[k]
+		if v == "" || strings.ContainsAny(v, " \t") {
+			v = `"` + v + `"`
+		}
+		parts = append(parts, k+"="+v)
+	}
+	return strings.Join(parts, " ")
+}
+
+// LoadWatchFile reads and parses a watch file
+func LoadWatchFile(filename string) (*WatchFile, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	wf := &WatchFile{Filename: filename}
+	text := strings.TrimRight(string(content), "\r\n")
+	if text == "" {
+		return wf, nil
+	}
+	for i, raw := range strings.Split(text, "\n") {
+		raw = strings.TrimRight(raw, "\r")
+		spec, err := parseWatchLine(raw)
+		if err != nil {
+			log.Warnf("Skipping %s:%d: %v", filename, i+1, err)
+		}
+		wf.lines = append(wf.lines, watchLine{raw: raw, spec: spec})
+	}
+	return wf, nil
+}
+
+// Feeds returns the feeds in the order they appear in the file
+func (wf *WatchFile) Feeds() []FeedSpec {
+	feeds := make([]FeedSpec, 0, len(wf.lines))
+	for _, l := range wf.lines {
+		if l.spec != nil {
+			feeds = append(feeds, *l.spec)
+		}
+	}
+	return feeds
+}
+
+// Find returns the feed with the given url
+func (wf *WatchFile) Find(feedURL string) (FeedSpec, bool) {
+	for _, l := range wf.lines {
+		if l.spec != nil && l.spec.URL == feedURL {
+			return *l.spec, true
+		}
+	}
+	return FeedSpec{}, false
+}
+
+// Add appends a feed to the end of the file
+func (wf *WatchFile) Add(spec FeedSpec) error {
+	if parsed, err := parseWatchLine(spec.URL); err != nil || parsed == nil || parsed.URL != spec.URL {
+		return fmt.Errorf("invalid url %q", spec.URL)
+	}
+	if _, exists := wf.Find(spec.URL); exists {
+		return fmt.Errorf("%s is already in %s", spec.URL, wf.Filename)
+	}
+	if spec.Opts == nil {
+		spec.Opts = make(map[string]string)
+	}
+	for k, v := range spec.Opts {
+		// quotes can't be escaped in a watch file so such values would not
+		// read back the same
+		if k == "" || strings.ContainsAny(k, " \t\r\n=\"") || strings.ContainsAny(v, "\r\n\"") {
+			return fmt.Errorf("option %s=%s can't be written to a watch file", k, v)
+		}
+	}
+	wf.lines = append(wf.lines, watchLine{raw: formatWatchLine(spec), spec: &spec})
+	return nil
+}
+
+// Remove drops the feed with the given url; returns false if it was not found
+func (wf *WatchFile) Remove(feedURL string) bool {
+	found := false
+	lines := wf.lines[:0]
+	for _, l := range wf.lines {
+		if l.spec != nil && l.spec.URL == feedURL {
+			found = true
+			continue
+		}
+		lines = append(lines, l)
+	}
+	wf.lines = lines
+	return found
+}
+
+// Save writes the file back to disk, keeping comments and ordering
+func (wf *WatchFile) Save() error {
+	var sb strings.Builder
+	for _, l := range wf.lines {
+		sb.WriteString(l.raw)
+		sb.WriteString("\n")
+	}
+	tmp := wf.Filename + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(sb.String()), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, wf.Filename)
+}
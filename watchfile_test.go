@@ -0,0 +1,82 @@
+package feednotifier
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseWatchLine(t *testing.T) {
+	spec, err := parseWatchLine(`https://zooqle.com/rss?q=a+b  label="Modern Family" tags=tv`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.URL != "https://zooqle.com/rss?q=a+b" || spec.Opts["label"] != "Modern Family" || spec.Opts["tags"] != "tv" {
+		t.Errorf("unexpected spec %#v", spec)
+	}
+	for _, line := range []string{"", "   ", "# https://commented.out/rss"} {
+		if spec, err := parseWatchLine(line); spec != nil || err != nil {
+			t.Errorf("expected %q to be skipped", line)
+		}
+	}
+	if _, err := parseWatchLine(`https://a.com/rss label="unterminated`); err == nil {
+		t.Errorf("expected error for unterminated quote")
+	}
+	if _, err := parseWatchLine(`https://a.com/rss novalue`); err == nil {
+		t.Errorf("expected error for option without value")
+	}
+}
+
+func TestWatchFileRewrite(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "feednotifier")
+	defer os.RemoveAll(dir)
+	fn := filepath.Join(dir, "watch.txt")
+	ioutil.WriteFile(fn, []byte("# first\nhttps://a.com/rss\n\n# second\nhttps://b.com/rss tags=tv\n"), 0644)
+
+	wf, err := LoadWatchFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(wf.Feeds()) != 2 {
+		t.Fatalf("expected 2 feeds, got %v", wf.Feeds())
+	}
+	if err := wf.Add(FeedSpec{URL: "https://a.com/rss"}); err == nil {
+		t.Errorf("expected error adding duplicate url")
+	}
+	wf.Add(FeedSpec{URL: "https://c.com/rss", Opts: map[string]string{"label": "C feed"}})
+	if !wf.Remove("https://a.com/rss") {
+		t.Errorf("expected url to be removed")
+	}
+	if err := wf.Save(); err != nil {
+		t.Fatal(err)
+	}
+	content, _ := ioutil.ReadFile(fn)
+	expected := "# first\n\n# second\nhttps://b.com/rss tags=tv\nhttps://c.com/rss label=\"C feed\"\n"
+	if string(content) != expected {
+		t.Errorf("unexpected file content:\n%s", content)
+	}
+}
+
+func TestWatchFileMalformedLines(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "feednotifier")
+	defer os.RemoveAll(dir)
+	fn := filepath.Join(dir, "watch.txt")
+	text := "https://a.com/rss label=\"unterminated\nhttps://b.com/rss\n"
+	ioutil.WriteFile(fn, []byte(text), 0644)
+
+	wf, err := LoadWatchFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feeds := wf.Feeds(); len(feeds) != 1 || feeds[0].URL != "https://b.com/rss" {
+		t.Fatalf("expected the malformed line to be skipped, got %v", feeds)
+	}
+	if err := wf.Add(FeedSpec{URL: "https://c.com/rss", Opts: map[string]string{"label": `say "hi"`}}); err == nil {
+		t.Errorf("expected an error for a value with quotes")
+	}
+	wf.Save()
+	if content, _ := ioutil.ReadFile(fn); string(content) != text {
+		t.Errorf("expected the malformed line to be kept, got:\n%s", content)
+	}
+}